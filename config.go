@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// fileConfig is the optional JSON configuration file (CONFIG_FILE) for
+// settings that do not fit into environment variables
+type fileConfig struct {
+	Routes             []route             `json:"routes"`
+	MaintenanceWindows []maintenanceWindow `json:"maintenance_windows"`
+}
+
+// route sends the alerts of one Alertmanager receiver to their own topic
+type route struct {
+	Receiver string `json:"receiver"`
+	Topic    string `json:"topic"`
+}
+
+// loadConfig reads and validates the configuration file. Unknown fields are
+// rejected so typos do not silently disable a route.
+func loadConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg fileConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, r := range cfg.Routes {
+		if r.Receiver == "" || r.Topic == "" {
+			return nil, fmt.Errorf("invalid config file %s: route %d needs both receiver and topic", path, i)
+		}
+		if seen[r.Receiver] {
+			return nil, fmt.Errorf("invalid config file %s: duplicate route for receiver %q", path, r.Receiver)
+		}
+		seen[r.Receiver] = true
+	}
+	for i := range cfg.MaintenanceWindows {
+		if err := cfg.MaintenanceWindows[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// router maps Alertmanager receivers to MQTT topics
+type router struct {
+	defaultTopic string
+	topics       map[string]string
+}
+
+func newRouter(defaultTopic string, routes []route) *router {
+	r := &router{defaultTopic: defaultTopic, topics: make(map[string]string, len(routes))}
+	for _, rt := range routes {
+		r.topics[rt.Receiver] = rt.Topic
+	}
+	return r
+}
+
+// topicFor returns the topic for receiver, falling back to the default topic
+func (r *router) topicFor(receiver string) string {
+	if topic, ok := r.topics[receiver]; ok {
+		return topic
+	}
+	return r.defaultTopic
+}
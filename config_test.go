@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"empty object", `{}`, ""},
+		{
+			"routes and windows",
+			`{"routes": [{"receiver": "nas", "topic": "homelab/nas"}],
+			  "maintenance_windows": [{"name": "backup", "schedule": {"days": ["sun"], "start": "02:00", "end": "04:00"}}]}`,
+			"",
+		},
+		{"not json", `routes: []`, "invalid config file"},
+		{"unknown field", `{"route": []}`, `unknown field "route"`},
+		{"unknown route field", `{"routes": [{"receiver": "nas", "topics": "homelab/nas"}]}`, `unknown field "topics"`},
+		{"route without topic", `{"routes": [{"receiver": "nas"}]}`, "route 0 needs both receiver and topic"},
+		{"route without receiver", `{"routes": [{"topic": "homelab/nas"}]}`, "route 0 needs both receiver and topic"},
+		{
+			"duplicate receiver",
+			`{"routes": [{"receiver": "nas", "topic": "a"}, {"receiver": "nas", "topic": "b"}]}`,
+			`duplicate route for receiver "nas"`,
+		},
+		{
+			"invalid window",
+			`{"maintenance_windows": [{"name": "backup", "schedule": {"days": ["someday"], "start": "02:00", "end": "04:00"}}]}`,
+			`invalid day "someday"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadConfig(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("loadConfig() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("loadConfig() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("loadConfig() = %v, want a not-exist error", err)
+	}
+}
+
+func TestRouterTopicFor(t *testing.T) {
+	r := newRouter("homelab/health", []route{
+		{Receiver: "nas", Topic: "homelab/nas"},
+		{Receiver: "router", Topic: "homelab/network"},
+	})
+
+	tests := []struct {
+		receiver string
+		want     string
+	}{
+		{"nas", "homelab/nas"},
+		{"router", "homelab/network"},
+		{"NAS", "homelab/health"},
+		{"other", "homelab/health"},
+		{"", "homelab/health"},
+	}
+	for _, tt := range tests {
+		if got := r.topicFor(tt.receiver); got != tt.want {
+			t.Errorf("topicFor(%q) = %q, want %q", tt.receiver, got, tt.want)
+		}
+	}
+}
@@ -18,7 +18,7 @@
           version = "0.1.0";
           src = ./.;
           subPackages = [ "." ];
-          vendorHash = "sha256-MI4E/GD3ExJgOKLzgK8+8YuCAxwZHI/GVOsL1rhsG9c=";
+          vendorHash = "sha256-/d3E1hLjE86qQgIObrS4kaygXYnOtmQMYjq34WAuIMA=";
         };
 
         # The actual binary name (Go uses directory/module name)
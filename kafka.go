@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaProbeInterval is how often broker reachability is checked for /health
+const kafkaProbeInterval = 30 * time.Second
+
+type kafkaConfig struct {
+	Brokers []string
+	Topic   string
+	// AutoCreateTopic lets the writer create a missing topic on the broker
+	AutoCreateTopic bool
+}
+
+// kafkaSink writes state messages to a single Kafka topic keyed by the MQTT
+// topic, so all states of one topic land in the same partition in order and a
+// compacted topic keeps the latest state per key like a retained message.
+type kafkaSink struct {
+	brokers []string
+	writer  *kafka.Writer
+	// healthy reflects the latest probe or write, whichever came last; the
+	// writer itself has no notion of a connection
+	healthy atomic.Bool
+}
+
+func newKafkaSink(cfg kafkaConfig) *kafkaSink {
+	s := &kafkaSink{
+		brokers: cfg.Brokers,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.Brokers...),
+			Topic:                  cfg.Topic,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: cfg.AutoCreateTopic,
+			// Every publish is a synchronous single message, so do not wait
+			// for a batch to fill up
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+
+	slog.Info("connecting to kafka", "brokers", cfg.Brokers, "kafka_topic", cfg.Topic)
+	if err := s.probe(); err != nil {
+		slog.Warn("kafka not reachable yet", "brokers", cfg.Brokers, "error", err)
+	}
+	go s.watch()
+	return s
+}
+
+// probe fetches the cluster metadata from the first reachable broker and
+// records the result
+func (s *kafkaSink) probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var errs []error
+	for _, b := range s.brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", b)
+		if err == nil {
+			_, err = conn.Brokers()
+			conn.Close()
+		}
+		if err == nil {
+			s.healthy.Store(true)
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", b, err))
+	}
+	s.healthy.Store(false)
+	return errors.Join(errs...)
+}
+
+// watch re-probes the brokers periodically, so the reported state follows
+// Kafka even while no state is published
+func (s *kafkaSink) watch() {
+	ticker := time.NewTicker(kafkaProbeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		wasHealthy := s.healthy.Load()
+		err := s.probe()
+		switch {
+		case err != nil && wasHealthy:
+			slog.Warn("kafka not reachable", "brokers", s.brokers, "error", err)
+		case err == nil && !wasHealthy:
+			slog.Info("kafka reachable again", "brokers", s.brokers)
+		}
+	}
+}
+
+func (s *kafkaSink) Name() string {
+	return sinkKafka
+}
+
+func (s *kafkaSink) Publish(ctx context.Context, logger *slog.Logger, msg outgoingMessage) error {
+	m := kafka.Message{
+		Key:     []byte(msg.Topic),
+		Value:   msg.Payload,
+		Headers: []kafka.Header{{Key: "Content-Type", Value: []byte("application/json")}},
+	}
+	for _, k := range slices.Sorted(maps.Keys(msg.Properties)) {
+		if v := msg.Properties[k]; v != "" {
+			m.Headers = append(m.Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+	}
+
+	logger.Debug("publishing kafka message", "kafka_topic", s.writer.Topic, "key", msg.Topic)
+	err := s.writer.WriteMessages(ctx, m)
+	s.healthy.Store(err == nil)
+	return err
+}
+
+func (s *kafkaSink) Status() []brokerStatus {
+	return []brokerStatus{{
+		Sink:      sinkKafka,
+		Broker:    strings.Join(s.brokers, ","),
+		Connected: s.healthy.Load(),
+	}}
+}
@@ -1,25 +1,40 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type webhookPayload struct {
-	Alerts []alert `json:"alerts"`
+	Receiver string  `json:"receiver"`
+	Alerts   []alert `json:"alerts"`
 }
 
 type alert struct {
 	Status      string            `json:"status"`
 	Labels      map[string]string `json:"labels"`
+	StartsAt    time.Time         `json:"startsAt"`
 	Fingerprint string            `json:"fingerprint"`
 }
 
@@ -27,6 +42,16 @@ type mqttMessage struct {
 	State        string `json:"state"`
 	ActiveAlerts int    `json:"active_alerts"`
 	Source       string `json:"source"`
+	Maintenance  bool   `json:"maintenance,omitempty"`
+}
+
+// topicState is the merged state of all active alerts of one topic
+type topicState struct {
+	State        string
+	ActiveAlerts int
+	// Maintenance is set while an active maintenance window covers at least
+	// one of the topic's alerts, or covers all alerts
+	Maintenance bool
 }
 
 var severityRank = map[string]int{
@@ -37,105 +62,444 @@ var severityRank = map[string]int{
 	"critical": 4,
 }
 
-// activeAlerts tracks all currently firing alerts by fingerprint
+// activeAlerts tracks all currently firing alerts by topic and fingerprint
 type activeAlert struct {
-	Fingerprint string
-	Severity    string
+	Topic       string            `json:"topic"`
+	Receiver    string            `json:"receiver,omitempty"`
+	Fingerprint string            `json:"fingerprint"`
+	Severity    string            `json:"severity"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	StartsAt    time.Time         `json:"starts_at,omitzero"`
 }
 
 var (
-	activeAlertsMap = make(map[string]activeAlert)
+	activeAlertsMap = make(map[string]map[string]activeAlert)
 	alertsMutex     sync.RWMutex
 )
 
 func main() {
 	listenAddr := getEnv("HTTP_LISTEN_ADDR", ":8080")
-	broker := getEnv("MQTT_BROKER", "tcp://mosquitto:1883")
+	brokers := parseBrokers(getEnv("MQTT_BROKER", "tcp://mosquitto:1883"))
+	brokerMode := strings.ToLower(getEnv("MQTT_BROKER_MODE", brokerModeFailover))
 	topic := getEnv("MQTT_TOPIC", "homelab/health")
 	clientID := getEnv("MQTT_CLIENT_ID", "alertmanager-mqtt-bridge")
+	protocolVersion := getEnv("MQTT_PROTOCOL_VERSION", protocolV3)
 	mqttUser := strings.TrimSpace(os.Getenv("MQTT_USERNAME"))
 	mqttPass := strings.TrimSpace(os.Getenv("MQTT_PASSWORD"))
+	stateFile := strings.TrimSpace(os.Getenv("STATE_FILE"))
+	configFile := strings.TrimSpace(os.Getenv("CONFIG_FILE"))
+	commandTopic := strings.TrimSpace(os.Getenv("MQTT_COMMAND_TOPIC"))
+	alertmanagerURL := strings.TrimSpace(os.Getenv("ALERTMANAGER_URL"))
+	silenceTopic := getEnv("MQTT_SILENCE_TOPIC", topic+"/silence")
+	hmacSecret := strings.TrimSpace(os.Getenv("WEBHOOK_HMAC_SECRET"))
+	hmacHeader := getEnv("WEBHOOK_HMAC_HEADER", "X-Signature-256")
+	natsURL := getEnv("NATS_URL", "nats://nats:4222")
+	natsUser := strings.TrimSpace(os.Getenv("NATS_USERNAME"))
+	natsPass := strings.TrimSpace(os.Getenv("NATS_PASSWORD"))
+	kafkaBrokers := parseBrokers(getEnv("KAFKA_BROKERS", "kafka:9092"))
+	kafkaTopic := getEnv("KAFKA_TOPIC", strings.ReplaceAll(topic, "/", "."))
+
+	logger, err := newLogger(getEnv("LOG_LEVEL", "info"), getEnv("LOG_FORMAT", "text"))
+	if err != nil {
+		slog.Error("invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
 
-	log.Printf("starting alertmanager-webhook-mqtt-bridge")
-	log.Printf("configuration: broker=%s, topic=%s, client_id=%s, listen_addr=%s", broker, topic, clientID, listenAddr)
+	// Report every invalid setting at once instead of one per restart
+	var env envSettings
+	messageExpiry := env.duration("MQTT_MESSAGE_EXPIRY", 0)
+	sessionExpiry := env.duration("MQTT_SESSION_EXPIRY", 0)
+	qos := env.int("MQTT_QOS", 1)
+	env.check(qos >= 0 && qos <= 2, "invalid MQTT_QOS %d: must be 0, 1 or 2", qos)
+	retain := env.bool("MQTT_RETAIN", true)
+	cleanSession := env.bool("MQTT_CLEAN_SESSION", true)
+	keepAlive := env.duration("MQTT_KEEPALIVE", 30*time.Second)
+	env.check(keepAlive >= time.Second && keepAlive <= 65535*time.Second, "invalid MQTT_KEEPALIVE %s: must be between 1s and 65535s", keepAlive)
+	maxReconnectInterval := env.duration("MQTT_MAX_RECONNECT_INTERVAL", 10*time.Minute)
+	env.check(maxReconnectInterval > 0, "invalid MQTT_MAX_RECONNECT_INTERVAL %s: must be positive", maxReconnectInterval)
+	queueSize := env.int("PUBLISH_QUEUE_SIZE", 100)
+	env.check(queueSize >= 1, "invalid PUBLISH_QUEUE_SIZE %d: must be at least 1", queueSize)
+	readHeaderTimeout := env.duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second)
+	readTimeout := env.duration("HTTP_READ_TIMEOUT", 30*time.Second)
+	writeTimeout := env.duration("HTTP_WRITE_TIMEOUT", 30*time.Second)
+	idleTimeout := env.duration("HTTP_IDLE_TIMEOUT", 2*time.Minute)
+	maxBodyBytes := env.int("HTTP_MAX_BODY_BYTES", 1<<20)
+	env.check(maxBodyBytes >= 1, "invalid HTTP_MAX_BODY_BYTES %d: must be positive", maxBodyBytes)
+	enableLifecycle := env.bool("HTTP_ENABLE_LIFECYCLE", false)
+	kafkaAutoCreate := env.bool("KAFKA_AUTO_CREATE_TOPIC", false)
+	sinkNames, err := parseSinks(getEnv("SINK", sinkMQTT))
+	env.add(err)
+	if err := env.err(); err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	if protocolVersion != protocolV5 && (messageExpiry > 0 || sessionExpiry > 0) {
+		slog.Warn("MQTT_MESSAGE_EXPIRY and MQTT_SESSION_EXPIRY require MQTT_PROTOCOL_VERSION=5, ignoring")
+	}
+
+	slog.Info("starting alertmanager-webhook-mqtt-bridge",
+		"sinks", sinkNames,
+		"brokers", brokers,
+		"broker_mode", brokerMode,
+		"topic", topic,
+		"client_id", clientID,
+		"protocol_version", protocolVersion,
+		"qos", qos,
+		"retain", retain,
+		"listen_addr", listenAddr,
+	)
+	cfg := &fileConfig{}
+	if configFile != "" {
+		if cfg, err = loadConfig(configFile); err != nil {
+			slog.Error("failed to load config file", "config_file", configFile, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("loaded config file", "config_file", configFile, "routes", len(cfg.Routes), "maintenance_windows", len(cfg.MaintenanceWindows))
+	}
 	if mqttUser != "" {
-		log.Printf("mqtt authentication enabled for user: %s", mqttUser)
+		slog.Info("mqtt authentication enabled", "username", mqttUser)
+	}
+	if hmacSecret != "" {
+		slog.Info("webhook signature verification enabled", "header", hmacHeader)
+	}
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if tracingEnabled() {
+		if shutdownTracing, err = setupTracing(context.Background()); err != nil {
+			slog.Error("tracing setup failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("otlp tracing enabled")
+	}
+	// flushTracing exports the spans still buffered before the process exits
+	flushTracing := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("failed to flush traces", "error", err)
+		}
+	}
+
+	// bridge stays nil without the mqtt sink; commands and silences need it
+	var bridge *mqttBridge
+	var outputs sinks
+	for _, name := range sinkNames {
+		switch name {
+		case sinkMQTT:
+			bridge, err = connectMQTT(mqttConfig{
+				Brokers:              brokers,
+				Mode:                 brokerMode,
+				ProtocolVersion:      protocolVersion,
+				ClientID:             clientID,
+				Username:             mqttUser,
+				Password:             mqttPass,
+				KeepAlive:            keepAlive,
+				MaxReconnectInterval: maxReconnectInterval,
+				CleanSession:         cleanSession,
+				SessionExpiry:        sessionExpiry,
+			})
+			if err != nil {
+				slog.Error("mqtt setup failed", "error", err)
+				os.Exit(1)
+			}
+			outputs = append(outputs, bridge)
+		case sinkNATS:
+			s, err := newNATSSink(natsConfig{
+				URL:      natsURL,
+				ClientID: clientID,
+				Username: natsUser,
+				Password: natsPass,
+			})
+			if err != nil {
+				slog.Error("nats setup failed", "error", err)
+				os.Exit(1)
+			}
+			outputs = append(outputs, s)
+		case sinkKafka:
+			outputs = append(outputs, newKafkaSink(kafkaConfig{
+				Brokers:         kafkaBrokers,
+				Topic:           kafkaTopic,
+				AutoCreateTopic: kafkaAutoCreate,
+			}))
+		}
 	}
 
-	client := connectMQTT(broker, clientID, mqttUser, mqttPass)
-	log.Printf("mqtt client connected successfully to %s", broker)
+	publisher := newStatePublisher(outputs, topic, publishOptions{
+		QoS:           byte(qos),
+		Retained:      retain,
+		MessageExpiry: messageExpiry,
+	}, queueSize, cfg.MaintenanceWindows)
+
+	reloader := newConfigReloader(configFile, topic, stateFile, cfg, publisher)
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	go func() {
+		for range reloadSignal {
+			logger := slog.With("signal", "SIGHUP")
+			if err := reloader.reload(logger); err != nil {
+				logger.Error("config reload failed", "config_file", configFile, "error", err)
+			}
+		}
+	}()
+
+	if stateFile != "" {
+		restored, err := loadState(stateFile, topic)
+		if err != nil {
+			slog.Error("failed to restore alert state", "state_file", stateFile, "error", err)
+			os.Exit(1)
+		}
+		if restored.SavedAt.IsZero() {
+			slog.Info("no saved alert state to restore", "state_file", stateFile)
+		} else {
+			// Re-publish right away so the retained message is correct without
+			// waiting for the next Alertmanager group interval
+			logger := slog.With("state_file", stateFile, "saved_at", restored.SavedAt)
+			// Like on a reload, alerts of receivers whose route changed while
+			// the bridge was down would otherwise never resolve
+			moved := reloader.rerouteRestored()
+			logger.Info("restored alert state", "moved_topics", moved)
+			if len(moved) > 0 {
+				if err := saveState(stateFile); err != nil {
+					logger.Warn("failed to persist alert state", "error", err)
+				}
+			}
+			// The old topics may have no alerts left, but still need their
+			// state cleared
+			topics := activeTopics()
+			for _, t := range moved {
+				if !slices.Contains(topics, t) {
+					topics = append(topics, t)
+				}
+			}
+			for _, t := range topics {
+				if err := publisher.Enqueue(context.Background(), logger, t, ""); err != nil {
+					logger.Warn("failed to queue restored state", "topic", t, "error", err)
+				}
+			}
+		}
+	}
+
+	if bridge == nil && (commandTopic != "" || alertmanagerURL != "") {
+		slog.Warn("MQTT_COMMAND_TOPIC and ALERTMANAGER_URL require the mqtt sink, ignoring")
+		commandTopic, alertmanagerURL = "", ""
+	}
+
+	if commandTopic != "" {
+		bridge.Subscribe(commandTopic, publisher.handleCommand)
+		slog.Info("listening for commands", "command_topic", commandTopic)
+	}
+
+	if alertmanagerURL != "" {
+		s := &silencer{
+			alertmanagerURL: alertmanagerURL,
+			createdBy:       clientID,
+			resultTopic:     silenceTopic + "/result",
+			bridge:          bridge,
+			httpClient:      &http.Client{Timeout: 15 * time.Second},
+		}
+		bridge.Subscribe(silenceTopic, s.handleMessage)
+		slog.Info("listening for silence requests", "silence_topic", silenceTopic, "result_topic", s.resultTopic, "alertmanager_url", alertmanagerURL)
+	}
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		
-		connected := client.IsConnected()
+
+		brokerStatuses := outputs.Status()
+		connected := 0
+		for _, s := range brokerStatuses {
+			if s.Connected {
+				connected++
+			}
+		}
+		depth, capacity := publisher.QueueDepth()
 		status := "healthy"
 		statusCode := http.StatusOK
-		
-		if !connected {
+
+		switch {
+		case connected == 0:
 			status = "unhealthy"
 			statusCode = http.StatusServiceUnavailable
-			log.Printf("health check: mqtt client not connected")
+			slog.Warn("health check: no sink connected", "sinks", outputs.Name())
+		case connected < len(brokerStatuses):
+			// Publishing still works through the remaining brokers
+			status = "degraded"
 		}
-		
+
 		response := map[string]interface{}{
-			"status":        status,
-			"mqtt_connected": connected,
-			"broker":        broker,
-			"topic":         topic,
+			"status":  status,
+			"sinks":   sinkNames,
+			"brokers": brokerStatuses,
+			"topic":   topic,
+			"publish_queue": map[string]int{
+				"depth":    depth,
+				"capacity": capacity,
+			},
 		}
-		
+
+		if bridge != nil {
+			mqttConnected := false
+			for _, s := range bridge.Status() {
+				mqttConnected = mqttConnected || s.Connected
+			}
+			response["mqtt_connected"] = mqttConnected
+			response["broker_mode"] = brokerMode
+		}
+
 		w.WriteHeader(statusCode)
 		json.NewEncoder(w).Encode(response)
 	})
 
-	http.HandleFunc("/alert", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("received alert webhook from %s", r.RemoteAddr)
-		
+	mux.HandleFunc("/alert", limitBody(int64(maxBodyBytes), traceWebhook(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		logger := slog.With("request_id", requestID(r), "remote_addr", r.RemoteAddr)
+		if sc := span.SpanContext(); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		logger.Debug("received alert webhook")
+
 		if r.Method != http.MethodPost {
-			log.Printf("method not allowed: %s (expected POST)", r.Method)
+			logger.Warn("method not allowed", "method", r.Method)
 			w.Header().Set("Allow", http.MethodPost)
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 		if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
-			log.Printf("unsupported content type: %s", ct)
+			logger.Warn("unsupported content type", "content_type", ct)
 			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
 			return
 		}
 
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				logger.Warn("request body too large", "limit_bytes", tooLarge.Limit)
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			logger.Warn("failed to read request body", "error", err)
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		if hmacSecret != "" {
+			if err := verifySignature([]byte(hmacSecret), r.Header.Get(hmacHeader), body); err != nil {
+				logger.Warn("rejected webhook", "header", hmacHeader, "error", err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
 		var payload webhookPayload
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&payload); err != nil {
-			log.Printf("failed to decode json payload: %v", err)
+		_, decodeSpan := tracer.Start(r.Context(), "decode webhook", trace.WithAttributes(attribute.Int("webhook.body_bytes", len(body))))
+		err = json.Unmarshal(body, &payload)
+		endSpan(decodeSpan, err)
+		if err != nil {
+			logger.Warn("failed to decode json payload", "error", err)
 			http.Error(w, "invalid json payload", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("processing webhook: %d alerts received", len(payload.Alerts))
-		
+		logger = logger.With("receiver", payload.Receiver, "alerts", len(payload.Alerts))
+		span.SetAttributes(
+			attribute.String("alertmanager.receiver", payload.Receiver),
+			attribute.Int("alertmanager.alerts", len(payload.Alerts)),
+		)
+
+		// Alertmanager retries requests it gave up on, so do not apply a
+		// payload nobody is waiting for anymore
+		if err := r.Context().Err(); err != nil {
+			logger.Warn("webhook request cancelled", "error", err)
+			return
+		}
+		logger.Debug("processing webhook")
+
 		// Update active alerts map based on this webhook
-		updateActiveAlerts(payload.Alerts)
-		
-		// Calculate state from all active alerts across all groups
-		state, active := calculateOverallState()
-		log.Printf("calculated overall state: %s (%d active alerts across all groups)", state, active)
-		
-		if err := publishState(client, topic, state, active); err != nil {
-			log.Printf("mqtt publish failed: %v", err)
-			http.Error(w, "failed to publish", http.StatusBadGateway)
+		_, trackSpan := tracer.Start(r.Context(), "update alerts")
+		topic := reloader.track(logger, payload.Receiver, payload.Alerts)
+		trackSpan.SetAttributes(attribute.String("messaging.destination.name", topic))
+		trackSpan.End()
+
+		if stateFile != "" {
+			if err := saveState(stateFile); err != nil {
+				logger.Warn("failed to persist alert state", "state_file", stateFile, "error", err)
+			}
+		}
+
+		// The worker publishes the state calculated from all active alerts
+		// of this topic across all groups; a full queue makes Alertmanager retry later.
+		// The publish outlives the request, so it keeps the request's context
+		// values but not its cancellation.
+		if err := publisher.Enqueue(context.WithoutCancel(r.Context()), logger, topic, payload.Receiver); err != nil {
+			logger.Error("failed to queue publish", "topic", topic, "error", err)
+			http.Error(w, "publish queue full", http.StatusServiceUnavailable)
 			return
 		}
 
-		log.Printf("successfully published state %s to topic %s", state, topic)
-		w.WriteHeader(http.StatusOK)
-	})
+		logger.Debug("queued state publish", "topic", topic)
+		w.WriteHeader(http.StatusAccepted)
+	})))
+
+	mux.Handle("/metrics", metricsHandler(outputs, publisher, reloader))
+	endpoints := "POST /alert, GET /health, GET /metrics, GET /status, GET /ui"
+	// Like Prometheus' --web.enable-lifecycle, since the endpoint is unauthenticated
+	if enableLifecycle {
+		mux.HandleFunc("/-/reload", reloadHandler(reloader))
+		endpoints = "POST /alert, POST /-/reload, GET /health, GET /metrics, GET /status, GET /ui"
+	}
+	mux.HandleFunc("/status", statusHandler(bridge, outputs, publisher, topic, protocolVersion))
+	mux.HandleFunc("/ui", statusPageHandler)
+
+	server := &http.Server{
+		Addr:              listenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
 
-	log.Printf("http server listening on %s", listenAddr)
-	log.Printf("endpoints: POST /alert, GET /health")
-	if err := http.ListenAndServe(listenAddr, nil); err != nil {
-		log.Fatalf("http server stopped: %v", err)
+	slog.Info("http server listening",
+		"listen_addr", listenAddr,
+		"endpoints", endpoints,
+		"read_timeout", readTimeout,
+		"write_timeout", writeTimeout,
+		"max_body_bytes", maxBodyBytes,
+	)
+
+	// On SIGTERM/SIGINT finish in-flight requests, publish what they queued,
+	// then flush traces
+	stopped := make(chan struct{})
+	stopSignal := make(chan os.Signal, 1)
+	signal.Notify(stopSignal, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-stopSignal
+		slog.Info("shutting down", "signal", sig.String())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("http server shutdown failed", "error", err)
+		}
+		// Webhooks were acknowledged before their publish, so Alertmanager
+		// will not resend what is still queued
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelDrain()
+		if err := publisher.Close(drainCtx); err != nil {
+			slog.Warn("failed to publish queued states", "error", err)
+		}
+		close(stopped)
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("http server stopped", "error", err)
+		flushTracing()
+		os.Exit(1)
 	}
+	<-stopped
+	flushTracing()
 }
 
 func getEnv(key, fallback string) string {
@@ -145,51 +509,152 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func connectMQTT(broker, clientID, username, password string) mqtt.Client {
-	log.Printf("connecting to mqtt broker: %s (client_id: %s)", broker, clientID)
-	
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(broker)
-	opts.SetClientID(clientID)
-	opts.SetAutoReconnect(true)
-	opts.SetConnectRetry(true)
-	opts.SetConnectRetryInterval(2 * time.Second)
-	
-	// Add connection event handlers for logging
-	opts.SetOnConnectHandler(func(c mqtt.Client) {
-		log.Printf("mqtt client connected (reconnect)")
-	})
-	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
-		log.Printf("mqtt connection lost: %v", err)
-	})
-	
-	if username != "" {
-		opts.SetUsername(username)
-		opts.SetPassword(password)
-		log.Printf("mqtt authentication configured")
+func getEnvInt(key string, fallback int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
 	}
+	return n, nil
+}
 
-	client := mqtt.NewClient(opts)
-	log.Printf("attempting mqtt connection...")
-	token := client.Connect()
-	if token.Wait() && token.Error() != nil {
-		log.Fatalf("mqtt connect failed: %v", token.Error())
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback, nil
 	}
-	log.Printf("mqtt connection established successfully")
-	return client
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return b, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return d, nil
+}
+
+// envSettings reads typed settings from the environment and collects the
+// errors of invalid ones. An invalid value yields the fallback, so range
+// checks on it do not report the same setting twice.
+type envSettings struct {
+	errs []error
+}
+
+func (e *envSettings) add(err error) {
+	if err != nil {
+		e.errs = append(e.errs, err)
+	}
+}
+
+// check records an error built from format and args unless ok holds
+func (e *envSettings) check(ok bool, format string, args ...any) {
+	if !ok {
+		e.add(fmt.Errorf(format, args...))
+	}
+}
+
+func (e *envSettings) int(key string, fallback int) int {
+	n, err := getEnvInt(key, fallback)
+	if err != nil {
+		e.add(err)
+		return fallback
+	}
+	return n
+}
+
+func (e *envSettings) bool(key string, fallback bool) bool {
+	b, err := getEnvBool(key, fallback)
+	if err != nil {
+		e.add(err)
+		return fallback
+	}
+	return b
+}
+
+func (e *envSettings) duration(key string, fallback time.Duration) time.Duration {
+	d, err := getEnvDuration(key, fallback)
+	if err != nil {
+		e.add(err)
+		return fallback
+	}
+	return d
+}
+
+// err returns all collected errors joined, or nil
+func (e *envSettings) err() error {
+	return errors.Join(e.errs...)
+}
+
+// newLogger builds the slog logger from LOG_LEVEL (debug, info, warn, error)
+// and LOG_FORMAT (text, json)
+func newLogger(level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q (expected text or json)", format)
+	}
+}
+
+// limitBody caps the request body at n bytes. It has to wrap the server's
+// own ResponseWriter, which MaxBytesReader tells to close the connection once
+// the limit is hit; wrappers like statusRecorder hide that hook.
+func limitBody(n int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next(w, r)
+	}
+}
+
+// requestID returns the caller-supplied X-Request-ID or generates a new one
+func requestID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get("X-Request-ID")); id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
 }
 
 // updateActiveAlerts processes a webhook payload and updates the global active alerts map
-func updateActiveAlerts(alerts []alert) {
+func updateActiveAlerts(logger *slog.Logger, topic, receiver string, alerts []alert) {
 	alertsMutex.Lock()
 	defer alertsMutex.Unlock()
 
+	topicAlerts := activeAlertsMap[topic]
+	if topicAlerts == nil {
+		topicAlerts = make(map[string]activeAlert)
+		activeAlertsMap[topic] = topicAlerts
+	}
+
 	for _, a := range alerts {
 		fingerprint := a.Fingerprint
 		if fingerprint == "" {
 			// Fallback: generate a simple fingerprint from labels if not provided
 			// This shouldn't happen with Alertmanager v2+, but handle it gracefully
-			log.Printf("warning: alert missing fingerprint, generating from labels")
+			logger.Warn("alert missing fingerprint, generating from labels", "labels", a.Labels)
 			fingerprint = generateFingerprint(a.Labels)
 		}
 
@@ -201,18 +666,57 @@ func updateActiveAlerts(alerts []alert) {
 					severity = s
 				}
 			}
-			activeAlertsMap[fingerprint] = activeAlert{
+			topicAlerts[fingerprint] = activeAlert{
+				Topic:       topic,
+				Receiver:    receiver,
 				Fingerprint: fingerprint,
 				Severity:    severity,
+				Labels:      a.Labels,
+				StartsAt:    a.StartsAt,
 			}
-			log.Printf("alert added/updated: fingerprint=%s, severity=%s", fingerprint, severity)
+			logger.Debug("alert added/updated", "fingerprint", fingerprint, "severity", severity)
 		} else if a.Status == "resolved" {
-			delete(activeAlertsMap, fingerprint)
-			log.Printf("alert resolved: fingerprint=%s", fingerprint)
+			delete(topicAlerts, fingerprint)
+			logger.Debug("alert resolved", "fingerprint", fingerprint)
 		}
 	}
 }
 
+// moveAlerts moves every alert whose receiver now routes to a different topic
+// and returns the old and new topics that changed, in sorted order. Alerts
+// without a receiver, e.g. restored from an older state file, stay put.
+func moveAlerts(topicFor func(receiver string) string) []string {
+	alertsMutex.Lock()
+	defer alertsMutex.Unlock()
+
+	changed := make(map[string]bool)
+	for topic, topicAlerts := range activeAlertsMap {
+		for fingerprint, a := range topicAlerts {
+			if a.Receiver == "" {
+				continue
+			}
+			target := topicFor(a.Receiver)
+			if target == topic {
+				continue
+			}
+			delete(topicAlerts, fingerprint)
+			a.Topic = target
+			if activeAlertsMap[target] == nil {
+				activeAlertsMap[target] = make(map[string]activeAlert)
+			}
+			activeAlertsMap[target][fingerprint] = a
+			changed[topic], changed[target] = true, true
+		}
+	}
+
+	topics := make([]string, 0, len(changed))
+	for t := range changed {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
 // generateFingerprint creates a simple fingerprint from labels (fallback)
 // This is deterministic by sorting keys
 func generateFingerprint(labels map[string]string) string {
@@ -231,52 +735,128 @@ func generateFingerprint(labels map[string]string) string {
 	return strings.Join(parts, ",")
 }
 
+// activeTopics returns the topics that have tracked alerts, or had some
+// since startup, in sorted order
+func activeTopics() []string {
+	alertsMutex.RLock()
+	defer alertsMutex.RUnlock()
+	topics := make([]string, 0, len(activeAlertsMap))
+	for t := range activeAlertsMap {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// snapshotActiveAlerts returns the active alerts of all topics ordered by
+// topic, severity (highest first), then by start time
+func snapshotActiveAlerts() []activeAlert {
+	alertsMutex.RLock()
+	var alerts []activeAlert
+	for _, topicAlerts := range activeAlertsMap {
+		for _, a := range topicAlerts {
+			alerts = append(alerts, a)
+		}
+	}
+	alertsMutex.RUnlock()
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Topic != alerts[j].Topic {
+			return alerts[i].Topic < alerts[j].Topic
+		}
+		ri, rj := severityRank[alerts[i].Severity], severityRank[alerts[j].Severity]
+		if ri != rj {
+			return ri > rj
+		}
+		if !alerts[i].StartsAt.Equal(alerts[j].StartsAt) {
+			return alerts[i].StartsAt.Before(alerts[j].StartsAt)
+		}
+		return alerts[i].Fingerprint < alerts[j].Fingerprint
+	})
+	return alerts
+}
+
 // calculateOverallState calculates the highest severity from all active alerts
-func calculateOverallState() (string, int) {
+// of topic. Alerts suppressed by an active maintenance window do not count;
+// downgraded alerts count with their capped severity.
+func calculateOverallState(topic string, windows []*maintenanceWindow) topicState {
 	alertsMutex.RLock()
 	defer alertsMutex.RUnlock()
 
-	if len(activeAlertsMap) == 0 {
-		return "NONE", 0
+	var result topicState
+	for _, w := range windows {
+		if len(w.Matchers) == 0 {
+			result.Maintenance = true
+		}
 	}
 
 	highest := ""
 	highestRank := -1
-	activeCount := 0
 
-	for _, alert := range activeAlertsMap {
-		activeCount++
-		rank, ok := severityRank[alert.Severity]
-		if !ok {
-			rank = severityRank["info"]
+	for _, alert := range activeAlertsMap[topic] {
+		severity, covered, suppressed := applyMaintenance(alert, windows)
+		if covered {
+			result.Maintenance = true
 		}
-		if rank > highestRank {
+		if suppressed {
+			continue
+		}
+		result.ActiveAlerts++
+		if rank := rankOf(severity); rank > highestRank {
 			highestRank = rank
-			highest = alert.Severity
+			highest = severity
 		}
 	}
 
-	return strings.ToUpper(highest), activeCount
+	result.State = "NONE"
+	if result.ActiveAlerts > 0 {
+		result.State = strings.ToUpper(highest)
+	}
+	return result
+}
+
+// rankOf returns the rank of severity; unknown severities rank as info
+func rankOf(severity string) int {
+	if rank, ok := severityRank[severity]; ok {
+		return rank
+	}
+	return severityRank["info"]
+}
+
+// publishOptions controls how state messages are delivered
+type publishOptions struct {
+	QoS      byte
+	Retained bool
+	// MessageExpiry is only sent with MQTT 5
+	MessageExpiry time.Duration
 }
 
-func publishState(client mqtt.Client, topic, state string, active int) error {
+// publishState publishes the state message. With MQTT 5 the message expires
+// after MessageExpiry (if set) so a vanished bridge does not leave a stale
+// retained state behind, and the source, receiver and trace context travel as
+// user properties (headers on NATS and Kafka).
+func publishState(ctx context.Context, logger *slog.Logger, sink Publisher, topic string, state topicState, receiver string, opts publishOptions) error {
 	message := mqttMessage{
-		State:        state,
-		ActiveAlerts: active,
+		State:        state.State,
+		ActiveAlerts: state.ActiveAlerts,
 		Source:       "alertmanager",
+		Maintenance:  state.Maintenance,
 	}
 	payload, err := json.Marshal(message)
 	if err != nil {
-		log.Printf("failed to marshal mqtt message: %v", err)
 		return err
 	}
 
-	log.Printf("publishing to topic %s: state=%s, active_alerts=%d", topic, state, active)
-	token := client.Publish(topic, 1, true, payload)
-	if token.Wait() && token.Error() != nil {
-		log.Printf("mqtt publish error: %v", token.Error())
-		return token.Error()
-	}
-	log.Printf("mqtt message published successfully (qos=1, retained=true)")
-	return nil
+	// Consumers can continue the webhook's trace from the message
+	props := map[string]string{"source": message.Source, "receiver": receiver}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(props))
+
+	return sink.Publish(ctx, logger, outgoingMessage{
+		Topic:      topic,
+		QoS:        opts.QoS,
+		Retained:   opts.Retained,
+		Payload:    payload,
+		Expiry:     opts.MessageExpiry,
+		Properties: props,
+	})
 }
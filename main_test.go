@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withActiveAlerts replaces the tracked alerts with m for the duration of the
+// test and restores the previous map afterwards
+func withActiveAlerts(t *testing.T, m map[string]map[string]activeAlert) {
+	t.Helper()
+	if m == nil {
+		m = make(map[string]map[string]activeAlert)
+	}
+	alertsMutex.Lock()
+	saved := activeAlertsMap
+	activeAlertsMap = m
+	alertsMutex.Unlock()
+	t.Cleanup(func() {
+		alertsMutex.Lock()
+		activeAlertsMap = saved
+		alertsMutex.Unlock()
+	})
+}
+
+func TestLimitBodyClosesConnection(t *testing.T) {
+	handler := limitBody(8, traceWebhook(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	tests := []struct {
+		body       string
+		wantStatus int
+		wantClose  bool
+	}{
+		{"{}", http.StatusAccepted, false},
+		{strings.Repeat("x", 64), http.StatusRequestEntityTooLarge, true},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus || resp.Close != tt.wantClose {
+			t.Errorf("body of %d bytes: status %d, close %v; want %d, close %v",
+				len(tt.body), resp.StatusCode, resp.Close, tt.wantStatus, tt.wantClose)
+		}
+	}
+}
+
+func TestEnvSettings(t *testing.T) {
+	t.Setenv("TEST_QOS", "7")
+	t.Setenv("TEST_KEEPALIVE", "soon")
+	t.Setenv("TEST_RETAIN", "false")
+	t.Setenv("TEST_QUEUE", "")
+
+	var env envSettings
+	qos := env.int("TEST_QOS", 1)
+	env.check(qos >= 0 && qos <= 2, "invalid TEST_QOS %d", qos)
+	// The fallback of an unparsable value passes the range check
+	keepAlive := env.duration("TEST_KEEPALIVE", 30*time.Second)
+	env.check(keepAlive >= time.Second, "invalid TEST_KEEPALIVE %s", keepAlive)
+	retain := env.bool("TEST_RETAIN", true)
+	queue := env.int("TEST_QUEUE", 100)
+
+	if keepAlive != 30*time.Second || retain || queue != 100 {
+		t.Errorf("got keepalive %s, retain %v, queue %d; want 30s, false, 100", keepAlive, retain, queue)
+	}
+	err := env.err()
+	if err == nil {
+		t.Fatal("err() = nil, want the invalid settings")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "TEST_QOS 7") || !strings.Contains(lines[1], `TEST_KEEPALIVE "soon"`) {
+		t.Errorf("err() = %q, want one error for TEST_QOS and one for TEST_KEEPALIVE", err)
+	}
+
+	var valid envSettings
+	valid.int("TEST_QUEUE", 1)
+	if err := valid.err(); err != nil {
+		t.Errorf("err() = %v, want nil", err)
+	}
+}
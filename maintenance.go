@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// maintenanceSuppress leaves matching alerts out of the published state
+	maintenanceSuppress = "suppress"
+	// maintenanceDowngrade caps the severity of matching alerts
+	maintenanceDowngrade = "downgrade"
+)
+
+// maintenanceWindow is a planned maintenance period from the config file.
+// It is either a one-off range (start/end) or a weekly schedule.
+type maintenanceWindow struct {
+	Name     string               `json:"name"`
+	Start    time.Time            `json:"start,omitzero"`
+	End      time.Time            `json:"end,omitzero"`
+	Schedule *maintenanceSchedule `json:"schedule,omitempty"`
+	// Matchers restrict the window to alerts whose labels equal all given
+	// values; without matchers the window covers every alert
+	Matchers    map[string]string `json:"matchers,omitempty"`
+	Action      string            `json:"action,omitempty"`
+	DowngradeTo string            `json:"downgrade_to,omitempty"`
+}
+
+// maintenanceSchedule recurs on the given weekdays between two times of day.
+// An end before the start crosses midnight, e.g. 22:00-02:00.
+type maintenanceSchedule struct {
+	Days     []string `json:"days,omitempty"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone,omitempty"`
+
+	days       map[time.Weekday]bool
+	start, end time.Duration
+	location   *time.Location
+}
+
+// weekdays maps the accepted day names, abbreviated or in full, to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// validate checks the window and fills in defaults and parsed fields
+func (w *maintenanceWindow) validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("maintenance window needs a name")
+	}
+	oneOff := !w.Start.IsZero() || !w.End.IsZero()
+	switch {
+	case oneOff && w.Schedule != nil:
+		return fmt.Errorf("maintenance window %q: use either start/end or schedule, not both", w.Name)
+	case oneOff:
+		if w.Start.IsZero() || w.End.IsZero() || !w.End.After(w.Start) {
+			return fmt.Errorf("maintenance window %q: end must be after start", w.Name)
+		}
+	case w.Schedule != nil:
+		if err := w.Schedule.parse(); err != nil {
+			return fmt.Errorf("maintenance window %q: %w", w.Name, err)
+		}
+	default:
+		return fmt.Errorf("maintenance window %q needs start/end or a schedule", w.Name)
+	}
+
+	switch w.Action {
+	case "":
+		w.Action = maintenanceSuppress
+	case maintenanceSuppress:
+	case maintenanceDowngrade:
+		if w.DowngradeTo == "" {
+			w.DowngradeTo = "info"
+		}
+		w.DowngradeTo = strings.ToLower(w.DowngradeTo)
+		if _, ok := severityRank[w.DowngradeTo]; !ok {
+			return fmt.Errorf("maintenance window %q: unknown downgrade_to severity %q", w.Name, w.DowngradeTo)
+		}
+	default:
+		return fmt.Errorf("maintenance window %q: invalid action %q (expected %s or %s)", w.Name, w.Action, maintenanceSuppress, maintenanceDowngrade)
+	}
+	return nil
+}
+
+func (s *maintenanceSchedule) parse() error {
+	var err error
+	if s.start, err = parseTimeOfDay(s.Start); err != nil {
+		return err
+	}
+	if s.end, err = parseTimeOfDay(s.End); err != nil {
+		return err
+	}
+	if s.start == s.end {
+		return fmt.Errorf("schedule start and end must differ")
+	}
+
+	s.location = time.Local
+	if s.Timezone != "" {
+		if s.location, err = time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+
+	s.days = make(map[time.Weekday]bool)
+	for _, d := range s.Days {
+		wd, ok := weekdays[strings.ToLower(strings.TrimSpace(d))]
+		if !ok {
+			return fmt.Errorf("invalid day %q", d)
+		}
+		s.days[wd] = true
+	}
+	return nil
+}
+
+// parseTimeOfDay parses "HH:MM" into an offset from midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// activeAt reports whether the window is in effect at now
+func (w *maintenanceWindow) activeAt(now time.Time) bool {
+	if w.Schedule == nil {
+		return !now.Before(w.Start) && now.Before(w.End)
+	}
+	return w.Schedule.activeAt(now)
+}
+
+func (s *maintenanceSchedule) activeAt(now time.Time) bool {
+	now = now.In(s.location)
+	// The wall clock time, not the time elapsed since midnight, which is an
+	// hour off on days the clocks change
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+
+	if s.start < s.end {
+		return s.onDay(now.Weekday()) && offset >= s.start && offset < s.end
+	}
+	// Crosses midnight: either the evening part of today's occurrence or the
+	// morning part of yesterday's
+	if offset >= s.start {
+		return s.onDay(now.Weekday())
+	}
+	return offset < s.end && s.onDay((now.Weekday()+6)%7)
+}
+
+func (s *maintenanceSchedule) onDay(d time.Weekday) bool {
+	return len(s.days) == 0 || s.days[d]
+}
+
+// matches reports whether the window covers an alert with labels
+func (w *maintenanceWindow) matches(labels map[string]string) bool {
+	for k, v := range w.Matchers {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// activeMaintenanceWindows returns the windows in effect at now
+func activeMaintenanceWindows(windows []maintenanceWindow, now time.Time) []*maintenanceWindow {
+	var active []*maintenanceWindow
+	for i := range windows {
+		if windows[i].activeAt(now) {
+			active = append(active, &windows[i])
+		}
+	}
+	return active
+}
+
+// applyMaintenance returns the severity an alert contributes to its topic's
+// state under the active windows, whether a window covers it, and whether it
+// is suppressed entirely
+func applyMaintenance(a activeAlert, windows []*maintenanceWindow) (severity string, covered, suppressed bool) {
+	severity = a.Severity
+	for _, w := range windows {
+		if !w.matches(a.Labels) {
+			continue
+		}
+		covered = true
+		switch w.Action {
+		case maintenanceSuppress:
+			suppressed = true
+		case maintenanceDowngrade:
+			if severityRank[w.DowngradeTo] < rankOf(severity) {
+				severity = w.DowngradeTo
+			}
+		}
+	}
+	return severity, covered, suppressed
+}
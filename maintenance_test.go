@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	start := time.Date(2026, 11, 7, 8, 0, 0, 0, time.UTC)
+	schedule := func(days ...string) *maintenanceSchedule {
+		return &maintenanceSchedule{Days: days, Start: "22:00", End: "02:00"}
+	}
+
+	tests := []struct {
+		name    string
+		window  maintenanceWindow
+		wantErr string
+	}{
+		{"one-off", maintenanceWindow{Name: "w", Start: start, End: start.Add(time.Hour)}, ""},
+		{"schedule", maintenanceWindow{Name: "w", Schedule: schedule("mon", "Friday", " SAT ")}, ""},
+		{"missing name", maintenanceWindow{Start: start, End: start.Add(time.Hour)}, "needs a name"},
+		{"no period", maintenanceWindow{Name: "w"}, "needs start/end or a schedule"},
+		{"both periods", maintenanceWindow{Name: "w", Start: start, End: start.Add(time.Hour), Schedule: schedule()}, "not both"},
+		{"end before start", maintenanceWindow{Name: "w", Start: start, End: start.Add(-time.Hour)}, "end must be after start"},
+		{"start only", maintenanceWindow{Name: "w", Start: start}, "end must be after start"},
+		{"prefix of a day", maintenanceWindow{Name: "w", Schedule: schedule("monkey")}, `invalid day "monkey"`},
+		{"day shrinking when lowercased", maintenanceWindow{Name: "w", Schedule: schedule("ẞ")}, `invalid day "ẞ"`},
+		{"empty day", maintenanceWindow{Name: "w", Schedule: schedule("")}, "invalid day"},
+		{"bad time of day", maintenanceWindow{Name: "w", Schedule: &maintenanceSchedule{Start: "25:00", End: "02:00"}}, "invalid time of day"},
+		{"empty schedule", maintenanceWindow{Name: "w", Schedule: &maintenanceSchedule{Start: "02:00", End: "02:00"}}, "must differ"},
+		{"bad timezone", maintenanceWindow{Name: "w", Schedule: &maintenanceSchedule{Start: "01:00", End: "02:00", Timezone: "Mars/Olympus"}}, "invalid timezone"},
+		{"bad action", maintenanceWindow{Name: "w", Schedule: schedule(), Action: "ignore"}, "invalid action"},
+		{"bad downgrade severity", maintenanceWindow{Name: "w", Schedule: schedule(), Action: maintenanceDowngrade, DowngradeTo: "meh"}, "unknown downgrade_to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.window.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowDefaults(t *testing.T) {
+	w := maintenanceWindow{Name: "w", Schedule: &maintenanceSchedule{Start: "01:00", End: "02:00"}}
+	if err := w.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Action != maintenanceSuppress {
+		t.Errorf("Action = %q, want %q", w.Action, maintenanceSuppress)
+	}
+
+	w = maintenanceWindow{Name: "w", Schedule: &maintenanceSchedule{Start: "01:00", End: "02:00"}, Action: maintenanceDowngrade}
+	if err := w.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if w.DowngradeTo != "info" {
+		t.Errorf("DowngradeTo = %q, want info", w.DowngradeTo)
+	}
+}
+
+func TestMaintenanceWindowActiveAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available:", err)
+	}
+	start := time.Date(2026, 11, 7, 8, 0, 0, 0, time.UTC)
+	// 2026-11-09 is a Monday
+	monday := func(hour, min int) time.Time { return time.Date(2026, 11, 9, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name   string
+		window maintenanceWindow
+		now    time.Time
+		want   bool
+	}{
+		{"one-off at start", maintenanceWindow{Start: start, End: start.Add(time.Hour)}, start, true},
+		{"one-off at end", maintenanceWindow{Start: start, End: start.Add(time.Hour)}, start.Add(time.Hour), false},
+		{"one-off before", maintenanceWindow{Start: start, End: start.Add(time.Hour)}, start.Add(-time.Second), false},
+
+		{"daytime inside", schedule(t, "10:00", "12:00", "UTC", "mon"), monday(11, 0), true},
+		{"daytime at end", schedule(t, "10:00", "12:00", "UTC", "mon"), monday(12, 0), false},
+		{"daytime other day", schedule(t, "10:00", "12:00", "UTC", "tue"), monday(11, 0), false},
+		{"every day without days", schedule(t, "10:00", "12:00", "UTC"), monday(10, 0), true},
+
+		{"overnight evening part", schedule(t, "22:00", "02:00", "UTC", "mon"), monday(23, 0), true},
+		{"overnight morning after", schedule(t, "22:00", "02:00", "UTC", "mon"), monday(23, 0).Add(2 * time.Hour), true},
+		{"overnight morning of start day", schedule(t, "22:00", "02:00", "UTC", "mon"), monday(1, 0), false},
+		{"overnight morning after sunday", schedule(t, "22:00", "02:00", "UTC", "sun"), monday(1, 0), true},
+		{"overnight gap", schedule(t, "22:00", "02:00", "UTC", "mon"), monday(12, 0), false},
+
+		// 10:30 UTC is 11:30 in Berlin in November
+		{"timezone inside", schedule(t, "11:00", "12:00", "Europe/Berlin", "mon"), monday(10, 30), true},
+		{"timezone outside", schedule(t, "11:00", "12:00", "Europe/Berlin", "mon"), monday(11, 30), false},
+		{"timezone day boundary", schedule(t, "00:00", "01:00", "Europe/Berlin", "tue"), monday(23, 30), true},
+		{"timezone input in other zone", schedule(t, "11:00", "12:00", "Europe/Berlin", "mon"), monday(10, 30).In(berlin), true},
+
+		// Clocks go from 02:00 CET to 03:00 CEST on 2026-03-29 and from 03:00
+		// CEST back to 02:00 CET on 2026-10-25, both Sundays
+		{"spring forward inside", schedule(t, "03:00", "04:00", "Europe/Berlin", "sun"), time.Date(2026, 3, 29, 3, 30, 0, 0, berlin), true},
+		{"spring forward after", schedule(t, "03:00", "04:00", "Europe/Berlin", "sun"), time.Date(2026, 3, 29, 4, 30, 0, 0, berlin), false},
+		{"spring forward before", schedule(t, "01:00", "02:00", "Europe/Berlin", "sun"), time.Date(2026, 3, 29, 1, 30, 0, 0, berlin), true},
+		{"fall back inside", schedule(t, "04:00", "05:00", "Europe/Berlin", "sun"), time.Date(2026, 10, 25, 4, 30, 0, 0, berlin), true},
+		{"fall back before", schedule(t, "04:00", "05:00", "Europe/Berlin", "sun"), time.Date(2026, 10, 25, 3, 30, 0, 0, berlin), false},
+		{"fall back overnight", schedule(t, "22:00", "04:00", "Europe/Berlin", "sat"), time.Date(2026, 10, 25, 3, 30, 0, 0, berlin), true},
+		{"fall back overnight end", schedule(t, "22:00", "04:00", "Europe/Berlin", "sat"), time.Date(2026, 10, 25, 4, 0, 0, 0, berlin), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.activeAt(tt.now); got != tt.want {
+				t.Errorf("activeAt(%s) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMaintenance(t *testing.T) {
+	suppressNAS := &maintenanceWindow{Matchers: map[string]string{"instance": "nas"}, Action: maintenanceSuppress}
+	downgradeBackup := &maintenanceWindow{Matchers: map[string]string{"job": "backup"}, Action: maintenanceDowngrade, DowngradeTo: "warning"}
+
+	tests := []struct {
+		name           string
+		alert          activeAlert
+		windows        []*maintenanceWindow
+		wantSeverity   string
+		wantCovered    bool
+		wantSuppressed bool
+	}{
+		{"no windows", activeAlert{Severity: "critical"}, nil, "critical", false, false},
+		{"not matching", activeAlert{Severity: "critical", Labels: map[string]string{"instance": "router"}}, []*maintenanceWindow{suppressNAS}, "critical", false, false},
+		{"suppressed", activeAlert{Severity: "critical", Labels: map[string]string{"instance": "nas"}}, []*maintenanceWindow{suppressNAS}, "critical", true, true},
+		{"downgraded", activeAlert{Severity: "critical", Labels: map[string]string{"job": "backup"}}, []*maintenanceWindow{downgradeBackup}, "warning", true, false},
+		{"downgrade never raises", activeAlert{Severity: "info", Labels: map[string]string{"job": "backup"}}, []*maintenanceWindow{downgradeBackup}, "info", true, false},
+		{"unknown severity ranks as info", activeAlert{Severity: "page", Labels: map[string]string{"job": "backup"}}, []*maintenanceWindow{downgradeBackup}, "page", true, false},
+		{"matcher-less window covers all", activeAlert{Severity: "error"}, []*maintenanceWindow{{Action: maintenanceDowngrade, DowngradeTo: "info"}}, "info", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			severity, covered, suppressed := applyMaintenance(tt.alert, tt.windows)
+			if severity != tt.wantSeverity || covered != tt.wantCovered || suppressed != tt.wantSuppressed {
+				t.Errorf("applyMaintenance() = (%q, %v, %v), want (%q, %v, %v)",
+					severity, covered, suppressed, tt.wantSeverity, tt.wantCovered, tt.wantSuppressed)
+			}
+		})
+	}
+}
+
+func TestCalculateOverallStateWithMaintenance(t *testing.T) {
+	withActiveAlerts(t, map[string]map[string]activeAlert{
+		"t": {
+			"a": {Topic: "t", Fingerprint: "a", Severity: "critical", Labels: map[string]string{"instance": "nas"}},
+			"b": {Topic: "t", Fingerprint: "b", Severity: "warning", Labels: map[string]string{"instance": "router"}},
+		},
+	})
+
+	got := calculateOverallState("t", nil)
+	if want := (topicState{State: "CRITICAL", ActiveAlerts: 2}); got != want {
+		t.Errorf("without windows = %+v, want %+v", got, want)
+	}
+
+	suppressNAS := &maintenanceWindow{Matchers: map[string]string{"instance": "nas"}, Action: maintenanceSuppress}
+	got = calculateOverallState("t", []*maintenanceWindow{suppressNAS})
+	if want := (topicState{State: "WARNING", ActiveAlerts: 1, Maintenance: true}); got != want {
+		t.Errorf("with suppress window = %+v, want %+v", got, want)
+	}
+
+	suppressAll := &maintenanceWindow{Action: maintenanceSuppress}
+	got = calculateOverallState("t", []*maintenanceWindow{suppressAll})
+	if want := (topicState{State: "NONE", Maintenance: true}); got != want {
+		t.Errorf("with matcher-less window = %+v, want %+v", got, want)
+	}
+}
+
+// schedule returns a validated window with a weekly schedule
+func schedule(t *testing.T, start, end, timezone string, days ...string) maintenanceWindow {
+	t.Helper()
+	w := maintenanceWindow{
+		Name:     "test",
+		Schedule: &maintenanceSchedule{Days: days, Start: start, End: end, Timezone: timezone},
+	}
+	if err := w.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// metricsHandler serves a small set of metrics in the Prometheus text
+// exposition format
+func metricsHandler(sink Publisher, publisher *statePublisher, reloader *configReloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		depth, capacity := publisher.QueueDepth()
+		fmt.Fprintln(w, "# HELP alertmanager_mqtt_bridge_publish_queue_depth Number of state publishes waiting for the worker.")
+		fmt.Fprintln(w, "# TYPE alertmanager_mqtt_bridge_publish_queue_depth gauge")
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_publish_queue_depth %d\n", depth)
+		fmt.Fprintln(w, "# HELP alertmanager_mqtt_bridge_publish_queue_capacity Maximum number of queued state publishes.")
+		fmt.Fprintln(w, "# TYPE alertmanager_mqtt_bridge_publish_queue_capacity gauge")
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_publish_queue_capacity %d\n", capacity)
+		fmt.Fprintln(w, "# HELP alertmanager_mqtt_bridge_publish_queue_dropped_total State publishes dropped because the publish queue was full, from webhooks (rejected with 503), retries, maintenance checks and commands.")
+		fmt.Fprintln(w, "# TYPE alertmanager_mqtt_bridge_publish_queue_dropped_total counter")
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_publish_queue_dropped_total %d\n", publisher.dropped.Load())
+
+		fmt.Fprintln(w, "# HELP alertmanager_mqtt_bridge_publishes_total State publishes processed by the worker, by result.")
+		fmt.Fprintln(w, "# TYPE alertmanager_mqtt_bridge_publishes_total counter")
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_publishes_total{result=\"success\"} %d\n", publisher.published.Load())
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_publishes_total{result=\"failure\"} %d\n", publisher.failed.Load())
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_publishes_total{result=\"suppressed\"} %d\n", publisher.suppressed.Load())
+
+		reloadOK, reloadSuccess := reloader.reloadStatus()
+		fmt.Fprintln(w, "# HELP alertmanager_mqtt_bridge_config_last_reload_successful Whether the last config reload attempt was successful.")
+		fmt.Fprintln(w, "# TYPE alertmanager_mqtt_bridge_config_last_reload_successful gauge")
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_config_last_reload_successful %d\n", boolToInt(reloadOK))
+		fmt.Fprintln(w, "# HELP alertmanager_mqtt_bridge_config_last_reload_success_timestamp_seconds Timestamp of the last successful config load.")
+		fmt.Fprintln(w, "# TYPE alertmanager_mqtt_bridge_config_last_reload_success_timestamp_seconds gauge")
+		fmt.Fprintf(w, "alertmanager_mqtt_bridge_config_last_reload_success_timestamp_seconds %d\n", reloadSuccess.Unix())
+
+		fmt.Fprintln(w, "# HELP alertmanager_mqtt_bridge_broker_connected Whether the broker connection of a sink is up.")
+		fmt.Fprintln(w, "# TYPE alertmanager_mqtt_bridge_broker_connected gauge")
+		for _, s := range sink.Status() {
+			fmt.Fprintf(w, "alertmanager_mqtt_bridge_broker_connected{sink=%q,broker=%q} %d\n", s.Sink, s.Broker, boolToInt(s.Connected))
+		}
+	})
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// brokerModeFailover connects a single client to the first reachable broker
+	// and lets paho fail over to the next one when the connection drops
+	brokerModeFailover = "failover"
+	// brokerModeAll connects one client per broker and publishes to every one
+	brokerModeAll = "all"
+)
+
+const (
+	protocolV3 = "3"
+	protocolV5 = "5"
+)
+
+type mqttConfig struct {
+	Brokers         []string
+	Mode            string
+	ProtocolVersion string
+	ClientID        string
+	Username        string
+	Password        string
+
+	KeepAlive            time.Duration
+	MaxReconnectInterval time.Duration
+	// CleanSession maps to Clean Start on the initial connection with MQTT 5
+	CleanSession bool
+	// SessionExpiry is only sent with MQTT 5
+	SessionExpiry time.Duration
+}
+
+// outgoingMessage is a protocol-independent publish. Expiry and properties
+// are dropped when talking MQTT 3.1.1.
+type outgoingMessage struct {
+	Topic      string
+	QoS        byte
+	Retained   bool
+	Payload    []byte
+	Expiry     time.Duration
+	Properties map[string]string
+}
+
+// messageHandler is called for every message received on a subscribed topic
+type messageHandler func(topic string, payload []byte)
+
+// subscriptions remembers the topics a connection is subscribed to so they
+// can be restored after a reconnect
+type subscriptions struct {
+	mu       sync.Mutex
+	handlers map[string]messageHandler
+}
+
+func (s *subscriptions) add(topic string, handler messageHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string]messageHandler)
+	}
+	s.handlers[topic] = handler
+}
+
+// get returns the handler of the subscription whose topic filter matches
+// topic, preferring an exact match
+func (s *subscriptions) get(topic string) (messageHandler, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.handlers[topic]; ok {
+		return h, true
+	}
+	for filter, h := range s.handlers {
+		if topicMatches(filter, topic) {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// topicMatches reports whether topic matches the MQTT topic filter, which may
+// contain the single-level wildcard "+" and a trailing multi-level "#"
+func topicMatches(filter, topic string) bool {
+	// Wildcards at the first level do not match topics starting with "$"
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, f := range filterLevels {
+		if f == "#" {
+			// "a/#" also matches its parent level "a"
+			return i == len(filterLevels)-1
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if f != "+" && f != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+func (s *subscriptions) snapshot() map[string]messageHandler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]messageHandler, len(s.handlers))
+	for t, h := range s.handlers {
+		out[t] = h
+	}
+	return out
+}
+
+// brokerConn is a single client connection that may fail over between the
+// broker URLs it was created with
+type brokerConn interface {
+	// connect blocks until the first connection is up or ctx is done; the
+	// client keeps retrying in the background in the latter case
+	connect(ctx context.Context) error
+	// publish blocks until the broker acknowledged the message or ctx is done
+	publish(ctx context.Context, msg outgoingMessage) error
+	// subscribe registers handler for topic; the subscription is renewed on
+	// every reconnect
+	subscribe(topic string, handler messageHandler) error
+	isConnected() bool
+	name() string
+}
+
+// mqttBridge publishes to one or more brokers depending on the broker mode
+type mqttBridge struct {
+	mode  string
+	conns []brokerConn
+	// sendMu serialises publishes per connection, so a resend after a
+	// reconnect never overwrites a newer message
+	sendMu []sync.Mutex
+
+	mu sync.Mutex
+	// retained holds the latest retained message per topic, which every
+	// broker should carry
+	retained map[string]outgoingMessage
+}
+
+type brokerStatus struct {
+	Sink      string `json:"sink"`
+	Broker    string `json:"broker"`
+	Connected bool   `json:"connected"`
+}
+
+// parseBrokers splits a comma-separated MQTT_BROKER value into broker URLs
+func parseBrokers(value string) []string {
+	var brokers []string
+	for _, b := range strings.Split(value, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	return brokers
+}
+
+func connectMQTT(cfg mqttConfig) (*mqttBridge, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("no mqtt broker configured")
+	}
+
+	var groups [][]string
+	switch cfg.Mode {
+	case brokerModeFailover:
+		groups = [][]string{cfg.Brokers}
+	case brokerModeAll:
+		for _, b := range cfg.Brokers {
+			groups = append(groups, []string{b})
+		}
+	default:
+		return nil, fmt.Errorf("invalid MQTT_BROKER_MODE %q (expected %s or %s)", cfg.Mode, brokerModeFailover, brokerModeAll)
+	}
+
+	bridge := &mqttBridge{
+		mode:     cfg.Mode,
+		sendMu:   make([]sync.Mutex, len(groups)),
+		retained: make(map[string]outgoingMessage),
+	}
+	for i, brokers := range groups {
+		onConnect := func() { go bridge.resend(i) }
+		var conn brokerConn
+		switch cfg.ProtocolVersion {
+		case protocolV3:
+			conn = newV3Conn(cfg, brokers, onConnect)
+		case protocolV5:
+			c, err := newV5Conn(cfg, brokers, onConnect)
+			if err != nil {
+				return nil, err
+			}
+			conn = c
+		default:
+			return nil, fmt.Errorf("invalid MQTT_PROTOCOL_VERSION %q (expected %s or %s)", cfg.ProtocolVersion, protocolV3, protocolV5)
+		}
+		slog.Info("connecting to mqtt broker", "broker", conn.name(), "client_id", cfg.ClientID, "protocol_version", cfg.ProtocolVersion)
+		bridge.conns = append(bridge.conns, conn)
+	}
+
+	if cfg.Mode == brokerModeFailover {
+		conn := bridge.conns[0]
+		if err := conn.connect(context.Background()); err != nil {
+			return nil, fmt.Errorf("mqtt connect to %s failed: %w", conn.name(), err)
+		}
+		return bridge, nil
+	}
+
+	// In "all" mode a single unreachable broker must not block startup, so
+	// wait a bounded time per broker and let the client keep retrying in the background
+	var wg sync.WaitGroup
+	for _, conn := range bridge.conns {
+		wg.Add(1)
+		go func(conn brokerConn) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := conn.connect(ctx); err != nil {
+				slog.Warn("mqtt broker not reachable yet, retrying in background", "broker", conn.name(), "error", err)
+			}
+		}(conn)
+	}
+	wg.Wait()
+	return bridge, nil
+}
+
+// Publish sends the message to the connected broker (failover mode) or to
+// every broker in parallel (all mode). In all mode the publish only fails if
+// no broker accepted the message, so one dead broker does not send the
+// worker into its retry loop; that broker gets the message once it is back
+// through resend.
+func (b *mqttBridge) Publish(ctx context.Context, logger *slog.Logger, msg outgoingMessage) error {
+	if msg.Retained {
+		b.mu.Lock()
+		b.retained[msg.Topic] = msg
+		b.mu.Unlock()
+	}
+
+	errs := make([]error, len(b.conns))
+	var wg sync.WaitGroup
+	for i, conn := range b.conns {
+		// paho queues publishes while reconnecting, which would hold the
+		// worker for the full publishTimeout until that broker comes back
+		if b.mode == brokerModeAll && !conn.isConnected() {
+			errs[i] = fmt.Errorf("%s: not connected", conn.name())
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.sendMu[i].Lock()
+			defer b.sendMu[i].Unlock()
+			// A broker that does not acknowledge only uses up its own timeout
+			connCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+			defer cancel()
+			logger.Debug("publishing mqtt message", "broker", conn.name(), "topic", msg.Topic, "qos", msg.QoS, "retained", msg.Retained)
+			if err := conn.publish(connCtx, msg); err != nil {
+				logger.Warn("mqtt publish to broker failed", "broker", conn.name(), "error", err)
+				errs[i] = fmt.Errorf("%s: %w", conn.name(), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == len(b.conns) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// resend publishes the latest retained message of every topic to connection
+// i after it (re)connected. In all mode the broker missed the publishes made
+// while it was down; in failover mode the broker failed over to may still
+// retain an older state if it does not share its store with the others.
+func (b *mqttBridge) resend(i int) {
+	conn := b.conns[i]
+	b.sendMu[i].Lock()
+	defer b.sendMu[i].Unlock()
+
+	b.mu.Lock()
+	msgs := make([]outgoingMessage, 0, len(b.retained))
+	for _, msg := range b.retained {
+		msgs = append(msgs, msg)
+	}
+	b.mu.Unlock()
+
+	for _, msg := range msgs {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		err := conn.publish(ctx, msg)
+		cancel()
+		if err != nil {
+			// The next connect tries again
+			slog.Warn("mqtt resend after connect failed", "broker", conn.name(), "topic", msg.Topic, "error", err)
+			return
+		}
+		slog.Debug("mqtt resent retained message after connect", "broker", conn.name(), "topic", msg.Topic)
+	}
+}
+
+func (b *mqttBridge) Name() string {
+	return sinkMQTT
+}
+
+// Subscribe subscribes every broker connection to topic
+func (b *mqttBridge) Subscribe(topic string, handler messageHandler) {
+	for _, conn := range b.conns {
+		if err := conn.subscribe(topic, handler); err != nil {
+			slog.Warn("mqtt subscribe failed, retrying on reconnect", "broker", conn.name(), "topic", topic, "error", err)
+		}
+	}
+}
+
+// Status returns the connection state of every broker connection
+func (b *mqttBridge) Status() []brokerStatus {
+	statuses := make([]brokerStatus, 0, len(b.conns))
+	for _, conn := range b.conns {
+		statuses = append(statuses, brokerStatus{
+			Sink:      sinkMQTT,
+			Broker:    conn.name(),
+			Connected: conn.isConnected(),
+		})
+	}
+	return statuses
+}
+
+// v3Conn is an MQTT 3.1.1 connection using paho.mqtt.golang
+type v3Conn struct {
+	brokers []string
+	client  mqtt.Client
+	subs    subscriptions
+}
+
+// newV3Conn creates the connection; onConnect is called after every
+// successful connect
+func newV3Conn(cfg mqttConfig, brokers []string, onConnect func()) *v3Conn {
+	conn := &v3Conn{brokers: brokers}
+
+	opts := mqtt.NewClientOptions()
+	for _, b := range brokers {
+		opts.AddBroker(b)
+	}
+	opts.SetClientID(cfg.ClientID)
+	opts.SetKeepAlive(cfg.KeepAlive)
+	opts.SetCleanSession(cfg.CleanSession)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(cfg.MaxReconnectInterval)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(2 * time.Second)
+
+	// Add connection event handlers for logging
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		slog.Info("mqtt client connected", "broker", conn.name())
+		// Clean sessions drop subscriptions, so renew them on every connect
+		for topic, handler := range conn.subs.snapshot() {
+			if err := conn.subscribeNow(topic, handler); err != nil {
+				slog.Warn("mqtt subscribe failed", "broker", conn.name(), "topic", topic, "error", err)
+			}
+		}
+		onConnect()
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		slog.Warn("mqtt connection lost", "broker", conn.name(), "error", err)
+	})
+
+	if cfg.Username != "" {
+		opts.SetUsername(cfg.Username)
+		opts.SetPassword(cfg.Password)
+	}
+
+	conn.client = mqtt.NewClient(opts)
+	return conn
+}
+
+func (c *v3Conn) connect(ctx context.Context) error {
+	token := c.client.Connect()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *v3Conn) publish(ctx context.Context, msg outgoingMessage) error {
+	token := c.client.Publish(msg.Topic, msg.QoS, msg.Retained, msg.Payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *v3Conn) subscribe(topic string, handler messageHandler) error {
+	c.subs.add(topic, handler)
+	if !c.isConnected() {
+		return nil
+	}
+	return c.subscribeNow(topic, handler)
+}
+
+func (c *v3Conn) subscribeNow(topic string, handler messageHandler) error {
+	token := c.client.Subscribe(topic, 1, func(_ mqtt.Client, m mqtt.Message) {
+		handler(m.Topic(), m.Payload())
+	})
+	if token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	slog.Debug("mqtt subscribed", "broker", c.name(), "topic", topic)
+	return nil
+}
+
+// isConnected reports whether the connection is up right now. IsConnected
+// also returns true while paho is still connecting or reconnecting.
+func (c *v3Conn) isConnected() bool {
+	return c.client.IsConnectionOpen()
+}
+
+func (c *v3Conn) name() string {
+	return strings.Join(c.brokers, ",")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// v5Conn is an MQTT 5 connection using paho.golang's autopaho, which
+// reconnects and cycles through its server URLs on its own
+type v5Conn struct {
+	brokers   []string
+	cfg       autopaho.ClientConfig
+	cm        *autopaho.ConnectionManager
+	connected atomic.Bool
+	subs      subscriptions
+}
+
+// newV5Conn creates the connection; onConnect is called after every
+// successful connect and must not block
+func newV5Conn(cfg mqttConfig, brokers []string, onConnect func()) (*v5Conn, error) {
+	conn := &v5Conn{brokers: brokers}
+
+	urls := make([]*url.URL, 0, len(brokers))
+	for _, b := range brokers {
+		u, err := url.Parse(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mqtt broker url %q: %w", b, err)
+		}
+		urls = append(urls, u)
+	}
+
+	conn.cfg = autopaho.ClientConfig{
+		ServerUrls:                    urls,
+		KeepAlive:                     uint16(cfg.KeepAlive / time.Second),
+		CleanStartOnInitialConnection: cfg.CleanSession,
+		SessionExpiryInterval:         uint32(cfg.SessionExpiry / time.Second),
+		ReconnectBackoff:              reconnectBackoff(cfg.MaxReconnectInterval),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			conn.connected.Store(true)
+			slog.Info("mqtt client connected", "broker", conn.name())
+			// Must not block, so renew subscriptions in the background
+			go func() {
+				for topic := range conn.subs.snapshot() {
+					if err := conn.subscribeNow(cm, topic); err != nil {
+						slog.Warn("mqtt subscribe failed", "broker", conn.name(), "topic", topic, "error", err)
+					}
+				}
+			}()
+			onConnect()
+		},
+		OnConnectionDown: func() bool {
+			conn.connected.Store(false)
+			slog.Warn("mqtt connection lost", "broker", conn.name())
+			return true
+		},
+		OnConnectError: func(err error) {
+			slog.Debug("mqtt connect attempt failed", "broker", conn.name(), "error", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: cfg.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					handler, ok := conn.subs.get(pr.Packet.Topic)
+					if !ok {
+						return false, nil
+					}
+					handler(pr.Packet.Topic, pr.Packet.Payload)
+					return true, nil
+				},
+			},
+		},
+	}
+	if cfg.Username != "" {
+		conn.cfg.ConnectUsername = cfg.Username
+		conn.cfg.ConnectPassword = []byte(cfg.Password)
+	}
+	return conn, nil
+}
+
+// reconnectBackoff starts at 2s and backs off exponentially up to max
+func reconnectBackoff(max time.Duration) autopaho.Backoff {
+	if max <= 2*time.Second {
+		return autopaho.NewConstantBackoff(max)
+	}
+	return autopaho.NewExponentialBackoff(time.Second, max, 2*time.Second, 2)
+}
+
+func (c *v5Conn) connect(ctx context.Context) error {
+	cm, err := autopaho.NewConnection(context.Background(), c.cfg)
+	if err != nil {
+		return err
+	}
+	c.cm = cm
+	return cm.AwaitConnection(ctx)
+}
+
+func (c *v5Conn) publish(ctx context.Context, msg outgoingMessage) error {
+	props := &paho.PublishProperties{
+		ContentType: "application/json",
+	}
+	if msg.Expiry > 0 {
+		expiry := uint32(msg.Expiry / time.Second)
+		props.MessageExpiry = &expiry
+	}
+	keys := make([]string, 0, len(msg.Properties))
+	for k := range msg.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := msg.Properties[k]; v != "" {
+			props.User.Add(k, v)
+		}
+	}
+
+	_, err := c.cm.Publish(ctx, &paho.Publish{
+		Topic:      msg.Topic,
+		QoS:        msg.QoS,
+		Retain:     msg.Retained,
+		Payload:    msg.Payload,
+		Properties: props,
+	})
+	return err
+}
+
+func (c *v5Conn) subscribe(topic string, handler messageHandler) error {
+	c.subs.add(topic, handler)
+	if !c.isConnected() {
+		return nil
+	}
+	return c.subscribeNow(c.cm, topic)
+}
+
+func (c *v5Conn) subscribeNow(cm *autopaho.ConnectionManager, topic string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	slog.Debug("mqtt subscribed", "broker", c.name(), "topic", topic)
+	return nil
+}
+
+func (c *v5Conn) isConnected() bool {
+	return c.connected.Load()
+}
+
+func (c *v5Conn) name() string {
+	return strings.Join(c.brokers, ",")
+}
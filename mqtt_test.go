@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"homelab/health/cmd", "homelab/health/cmd", true},
+		{"homelab/health/cmd", "homelab/health", false},
+		{"homelab/+/cmd", "homelab/health/cmd", true},
+		{"homelab/+/cmd", "homelab/health/sub/cmd", false},
+		{"homelab/+", "homelab/", true},
+		{"homelab/#", "homelab/health/cmd", true},
+		{"homelab/#", "homelab", true},
+		{"homelab/#", "other/health", false},
+		{"#", "homelab/health", true},
+		{"+/health", "homelab/health", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"+/broker", "$SYS/broker", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+		{"homelab/health", "homelab/health/cmd", false},
+	}
+	for _, tt := range tests {
+		if got := topicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type natsConfig struct {
+	URL      string
+	ClientID string
+	Username string
+	Password string
+}
+
+// natsSink publishes state messages to core NATS. MQTT topics map to
+// subjects by replacing "/" with ".", e.g. homelab/health -> homelab.health.
+// NATS has no retained messages; consumers that need the current state on
+// startup can capture the subject in a JetStream stream.
+type natsSink struct {
+	servers string
+	conn    *nats.Conn
+}
+
+func newNATSSink(cfg natsConfig) (*natsSink, error) {
+	s := &natsSink{servers: redactURLs(cfg.URL)}
+
+	opts := []nats.Option{
+		nats.Name(cfg.ClientID),
+		// Keep retrying in the background like the MQTT clients do, so an
+		// unreachable server does not block startup
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2 * time.Second),
+		nats.ConnectHandler(func(c *nats.Conn) {
+			slog.Info("nats client connected", "server", c.ConnectedUrlRedacted())
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			slog.Info("nats client reconnected", "server", c.ConnectedUrlRedacted())
+		}),
+		nats.DisconnectErrHandler(func(c *nats.Conn, err error) {
+			slog.Warn("nats connection lost", "servers", s.servers, "error", err)
+		}),
+	}
+	if cfg.Username != "" {
+		opts = append(opts, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+
+	slog.Info("connecting to nats", "servers", s.servers, "client_id", cfg.ClientID)
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect to %s failed: %w", s.servers, err)
+	}
+	s.conn = conn
+	return s, nil
+}
+
+func (s *natsSink) Name() string {
+	return sinkNATS
+}
+
+// Publish sends the message and flushes, so it only succeeds once the server
+// has processed it
+func (s *natsSink) Publish(ctx context.Context, logger *slog.Logger, msg outgoingMessage) error {
+	// The client buffers publishes while reconnecting, which would only
+	// surface as a flush timeout
+	if !s.conn.IsConnected() {
+		return errors.New("not connected")
+	}
+
+	m := nats.NewMsg(natsSubject(msg.Topic))
+	m.Data = msg.Payload
+	m.Header.Set("Content-Type", "application/json")
+	for k, v := range msg.Properties {
+		if v != "" {
+			m.Header.Set(k, v)
+		}
+	}
+
+	logger.Debug("publishing nats message", "subject", m.Subject)
+	if err := s.conn.PublishMsg(m); err != nil {
+		return err
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *natsSink) Status() []brokerStatus {
+	return []brokerStatus{{
+		Sink:      sinkNATS,
+		Broker:    s.servers,
+		Connected: s.conn.IsConnected(),
+	}}
+}
+
+// natsSubject converts an MQTT topic into a NATS subject
+func natsSubject(topic string) string {
+	return strings.ReplaceAll(strings.Trim(topic, "/"), "/", ".")
+}
+
+// redactURLs masks passwords in a comma-separated list of server URLs
+func redactURLs(value string) string {
+	var servers []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if u, err := url.Parse(s); err == nil {
+			s = u.Redacted()
+		}
+		servers = append(servers, s)
+	}
+	return strings.Join(servers, ",")
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// errQueueFull is returned by Enqueue when the worker cannot keep up
+	errQueueFull = errors.New("publish queue full")
+	// errPublisherClosed is returned by Enqueue once shutdown began
+	errPublisherClosed = errors.New("publisher closed")
+)
+
+// maintenanceCheckInterval is how often maintenance windows are re-evaluated
+// so window starts and ends are published without waiting for a webhook
+const maintenanceCheckInterval = 30 * time.Second
+
+// publishTimeout bounds a single publish including the broker acknowledgement
+const publishTimeout = 10 * time.Second
+
+// publishRetryInterval is how long the worker waits before retrying a
+// failed publish, so a broker outage does not leave a stale retained state.
+// It is a variable so tests can shorten it.
+var publishRetryInterval = 5 * time.Second
+
+// publishJob asks the worker to publish the state current at the time the
+// job is processed; jobs therefore never carry stale state
+type publishJob struct {
+	ctx      context.Context
+	logger   *slog.Logger
+	topic    string
+	receiver string
+	// sinks limits a retry to the sinks that failed; empty means all
+	sinks []string
+}
+
+// publishedState describes the last message on a topic accepted by the broker
+type publishedState struct {
+	State        string    `json:"state"`
+	ActiveAlerts int       `json:"active_alerts"`
+	Maintenance  bool      `json:"maintenance"`
+	Receiver     string    `json:"receiver,omitempty"`
+	PublishedAt  time.Time `json:"published_at"`
+}
+
+// statePublisher publishes the overall alert state from a worker goroutine
+// fed by a bounded queue, so webhooks never wait on the broker. It also owns
+// the mute switch that MQTT commands can flip.
+type statePublisher struct {
+	sink         sinks
+	defaultTopic string
+	opts         publishOptions
+	queue        chan publishJob
+	// done is closed once the worker processed the last queued job
+	done chan struct{}
+
+	// queueMu guards sending on queue against Close closing it
+	queueMu sync.RWMutex
+	closed  bool
+
+	mu          sync.Mutex
+	maintenance []maintenanceWindow
+	muted       bool
+	mutedUntil  time.Time // zero while muted means "until unmuted"
+	muteTimer   *time.Timer
+	// muteGen changes with every mute and unmute, so an expiry timer that
+	// fired too late to be stopped leaves a newer mute alone
+	muteGen      uint64
+	last         map[string]publishedState
+	retryPending map[string]map[string]bool // topic -> sinks to retry
+
+	published  atomic.Uint64
+	failed     atomic.Uint64
+	suppressed atomic.Uint64
+	dropped    atomic.Uint64
+}
+
+func newStatePublisher(sink sinks, defaultTopic string, opts publishOptions, queueSize int, maintenance []maintenanceWindow) *statePublisher {
+	p := &statePublisher{
+		sink:         sink,
+		defaultTopic: defaultTopic,
+		opts:         opts,
+		queue:        make(chan publishJob, queueSize),
+		done:         make(chan struct{}),
+		last:         make(map[string]publishedState),
+		retryPending: make(map[string]map[string]bool),
+		maintenance:  maintenance,
+	}
+	go p.run()
+	go p.watchMaintenance()
+	return p
+}
+
+// maintenanceWindows returns the configured maintenance windows
+func (p *statePublisher) maintenanceWindows() []maintenanceWindow {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maintenance
+}
+
+// setMaintenance replaces the maintenance windows on a config reload
+func (p *statePublisher) setMaintenance(windows []maintenanceWindow) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maintenance = windows
+}
+
+// currentState calculates the state of topic under the maintenance windows
+// active right now
+func (p *statePublisher) currentState(topic string) topicState {
+	return calculateOverallState(topic, activeMaintenanceWindows(p.maintenanceWindows(), time.Now()))
+}
+
+// watchMaintenance republishes topics whose state changed because a
+// maintenance window started or ended
+func (p *statePublisher) watchMaintenance() {
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if len(p.maintenanceWindows()) > 0 {
+			p.publishChanged(slog.Default())
+		}
+	}
+}
+
+// publishChanged queues a publish of every topic whose current state differs
+// from the one last published
+func (p *statePublisher) publishChanged(logger *slog.Logger) {
+	if muted, _ := p.muteStatus(); muted {
+		return
+	}
+	for _, topic := range p.topics() {
+		current := p.currentState(topic)
+		last, ok := p.lastPublished(topic)
+		if ok && last.State == current.State && last.ActiveAlerts == current.ActiveAlerts && last.Maintenance == current.Maintenance {
+			continue
+		}
+		logger.Debug("topic state changed", "topic", topic, "maintenance", current.Maintenance)
+		if err := p.Enqueue(context.Background(), logger, topic, ""); err != nil {
+			logger.Warn("failed to queue publish", "topic", topic, "error", err)
+		}
+	}
+}
+
+// Enqueue schedules a publish of topic's state without blocking. The worker
+// publishes with ctx, bounded by publishTimeout.
+func (p *statePublisher) Enqueue(ctx context.Context, logger *slog.Logger, topic, receiver string) error {
+	return p.enqueue(publishJob{ctx: ctx, logger: logger, topic: topic, receiver: receiver})
+}
+
+func (p *statePublisher) enqueue(job publishJob) error {
+	p.queueMu.RLock()
+	defer p.queueMu.RUnlock()
+	if p.closed {
+		return errPublisherClosed
+	}
+	select {
+	case p.queue <- job:
+		return nil
+	default:
+		p.dropped.Add(1)
+		return errQueueFull
+	}
+}
+
+// QueueDepth returns the number of pending publishes and the queue capacity
+func (p *statePublisher) QueueDepth() (int, int) {
+	return len(p.queue), cap(p.queue)
+}
+
+// Close stops accepting publishes and waits until the worker published
+// everything still queued, or ctx is done. Failed publishes are not retried
+// anymore.
+func (p *statePublisher) Close(ctx context.Context) error {
+	p.queueMu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.queueMu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d queued publishes not sent: %w", len(p.queue), ctx.Err())
+	}
+}
+
+func (p *statePublisher) run() {
+	defer close(p.done)
+	for job := range p.queue {
+		ctx, cancel := context.WithTimeout(job.ctx, publishTimeout)
+		err := p.publish(ctx, job.logger, job.topic, job.receiver, job.sinks)
+		cancel()
+		if err != nil {
+			p.failed.Add(1)
+			var se *sinkError
+			if errors.As(err, &se) {
+				job.sinks = se.failed
+			} else {
+				job.sinks = p.sink.only(job.sinks).names()
+			}
+			job.logger.Error("publish failed", "topic", job.topic, "sinks", job.sinks, "error", err)
+			if !p.isClosed() {
+				p.scheduleRetry(job)
+			}
+		}
+	}
+}
+
+func (p *statePublisher) isClosed() bool {
+	p.queueMu.RLock()
+	defer p.queueMu.RUnlock()
+	return p.closed
+}
+
+// scheduleRetry re-queues a failed publish to the sinks that failed after
+// publishRetryInterval. Only one retry per topic is pending at a time since
+// every job publishes the latest state; it covers every sink that failed.
+func (p *statePublisher) scheduleRetry(job publishJob) {
+	p.mu.Lock()
+	pending, scheduled := p.retryPending[job.topic]
+	if !scheduled {
+		pending = make(map[string]bool)
+		p.retryPending[job.topic] = pending
+	}
+	for _, name := range job.sinks {
+		pending[name] = true
+	}
+	p.mu.Unlock()
+	if scheduled {
+		return
+	}
+	time.AfterFunc(publishRetryInterval, func() {
+		p.mu.Lock()
+		job.sinks = slices.Sorted(maps.Keys(p.retryPending[job.topic]))
+		delete(p.retryPending, job.topic)
+		p.mu.Unlock()
+		if err := p.enqueue(job); err != nil {
+			job.logger.Warn("failed to queue publish retry", "error", err)
+		}
+	})
+}
+
+// publish calculates the current state of topic and publishes it to the
+// given sinks (all if empty) unless the bridge is muted. The state counts as
+// published as soon as one sink accepted it.
+func (p *statePublisher) publish(ctx context.Context, logger *slog.Logger, topic, receiver string, only []string) error {
+	target := p.sink.only(only)
+	_, stateSpan := tracer.Start(ctx, "compute state", trace.WithAttributes(attribute.String("messaging.destination.name", topic)))
+	state := p.currentState(topic)
+	stateSpan.SetAttributes(
+		attribute.String("alert.state", state.State),
+		attribute.Int("alert.active_alerts", state.ActiveAlerts),
+		attribute.Bool("alert.maintenance", state.Maintenance),
+	)
+	stateSpan.End()
+	logger = logger.With("topic", topic, "state", state.State, "active_alerts", state.ActiveAlerts, "maintenance", state.Maintenance)
+
+	if muted, until := p.muteStatus(); muted {
+		p.suppressed.Add(1)
+		logger.Info("publish suppressed, bridge is muted", "muted_until", until)
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "publish "+topic, trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("messaging.operation.type", "send"),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.system", target.Name()),
+	))
+	err := publishState(ctx, logger, target, topic, state, receiver, p.opts)
+	endSpan(span, err)
+	var se *sinkError
+	if err != nil && (!errors.As(err, &se) || len(se.failed) == len(target)) {
+		return err
+	}
+	if err == nil {
+		p.published.Add(1)
+	}
+	p.mu.Lock()
+	p.last[topic] = publishedState{
+		State:        state.State,
+		ActiveAlerts: state.ActiveAlerts,
+		Maintenance:  state.Maintenance,
+		Receiver:     receiver,
+		PublishedAt:  time.Now().UTC(),
+	}
+	p.mu.Unlock()
+	if err != nil {
+		logger.Warn("published alert state to some sinks only", "failed_sinks", se.failed)
+		return err
+	}
+	logger.Info("published alert state")
+	return nil
+}
+
+// lastPublished returns the last successfully published state of topic
+func (p *statePublisher) lastPublished(topic string) (publishedState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	last, ok := p.last[topic]
+	return last, ok
+}
+
+// topics returns the default topic plus every topic that has tracked alerts
+// or was published to, in sorted order
+func (p *statePublisher) topics() []string {
+	seen := map[string]bool{p.defaultTopic: true}
+	for _, t := range activeTopics() {
+		seen[t] = true
+	}
+	p.mu.Lock()
+	for t := range p.last {
+		seen[t] = true
+	}
+	p.mu.Unlock()
+
+	topics := make([]string, 0, len(seen))
+	for t := range seen {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (p *statePublisher) muteStatus() (bool, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.muted, p.mutedUntil
+}
+
+// mute suppresses publishes for d, or until unmute is called if d is zero
+func (p *statePublisher) mute(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clearMute()
+	p.muted = true
+	if d > 0 {
+		p.mutedUntil = time.Now().Add(d)
+		gen := p.muteGen
+		p.muteTimer = time.AfterFunc(d, func() { p.expireMute(gen) })
+	}
+}
+
+// unmute re-enables publishing and publishes the current state, which may
+// have changed while muted
+func (p *statePublisher) unmute() {
+	p.mu.Lock()
+	wasMuted := p.clearMute()
+	p.mu.Unlock()
+
+	if wasMuted {
+		p.republish(slog.Default())
+	}
+}
+
+// expireMute ends the mute of generation gen unless it was replaced since
+func (p *statePublisher) expireMute(gen uint64) {
+	p.mu.Lock()
+	if p.muteGen != gen {
+		p.mu.Unlock()
+		return
+	}
+	wasMuted := p.clearMute()
+	p.mu.Unlock()
+
+	if wasMuted {
+		slog.Info("mute expired")
+		p.republish(slog.Default())
+	}
+}
+
+// clearMute stops the expiry timer and lifts the mute, returning whether the
+// bridge was muted. p.mu must be held.
+func (p *statePublisher) clearMute() bool {
+	wasMuted := p.muted
+	p.muteGen++
+	if p.muteTimer != nil {
+		p.muteTimer.Stop()
+		p.muteTimer = nil
+	}
+	p.muted = false
+	p.mutedUntil = time.Time{}
+	return wasMuted
+}
+
+// republish queues a publish of every known topic
+func (p *statePublisher) republish(logger *slog.Logger) {
+	for _, topic := range p.topics() {
+		if err := p.Enqueue(context.Background(), logger, topic, ""); err != nil {
+			logger.Error("failed to queue publish", "topic", topic, "error", err)
+		}
+	}
+}
+
+// handleCommand executes a command received on the command topic:
+//
+//	republish        publish the current state again
+//	mute [duration]  suppress publishes, e.g. "mute 1h"; without a duration until "unmute"
+//	unmute           resume publishing and publish the current state
+func (p *statePublisher) handleCommand(topic string, payload []byte) {
+	fields := strings.Fields(strings.ToLower(string(payload)))
+	logger := slog.With("command_topic", topic, "command", strings.Join(fields, " "))
+	if len(fields) == 0 {
+		logger.Warn("ignoring empty command")
+		return
+	}
+
+	switch fields[0] {
+	case "republish":
+		if len(fields) != 1 {
+			logger.Warn("invalid command, usage: republish")
+			return
+		}
+		logger.Info("republishing state on command")
+		p.republish(logger)
+	case "mute":
+		var d time.Duration
+		switch len(fields) {
+		case 1:
+		case 2:
+			var err error
+			if d, err = time.ParseDuration(fields[1]); err != nil || d <= 0 {
+				logger.Warn("invalid mute duration", "duration", fields[1])
+				return
+			}
+		default:
+			logger.Warn("invalid command, usage: mute [duration]")
+			return
+		}
+		p.mute(d)
+		if d > 0 {
+			logger.Info("publishing muted", "duration", d)
+		} else {
+			logger.Info("publishing muted until unmute")
+		}
+	case "unmute":
+		if len(fields) != 1 {
+			logger.Warn("invalid command, usage: unmute")
+			return
+		}
+		logger.Info("publishing unmuted")
+		p.unmute()
+	default:
+		logger.Warn("unknown command")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink records the topics published to it. Publishes fail while fail is
+// set and wait for release if it is not nil.
+type fakeSink struct {
+	name    string
+	release chan struct{}
+
+	mu        sync.Mutex
+	fail      bool
+	published []string
+}
+
+func (s *fakeSink) Name() string { return s.name }
+
+func (s *fakeSink) Publish(ctx context.Context, _ *slog.Logger, msg outgoingMessage) error {
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.published = append(s.published, msg.Topic)
+	return nil
+}
+
+func (s *fakeSink) Status() []brokerStatus { return nil }
+
+func (s *fakeSink) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func (s *fakeSink) topics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.published)
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestStatePublisherCloseDrainsQueue(t *testing.T) {
+	withActiveAlerts(t, nil)
+	sink := &fakeSink{name: sinkMQTT, release: make(chan struct{})}
+	p := newStatePublisher(sinks{sink}, "t/default", publishOptions{}, 10, nil)
+
+	for _, topic := range []string{"t/a", "t/b", "t/c"} {
+		if err := p.Enqueue(context.Background(), discardLogger, topic, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- p.Close(context.Background()) }()
+	close(sink.release)
+
+	if err := <-closed; err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if got, want := sink.topics(), []string{"t/a", "t/b", "t/c"}; !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+	if err := p.Enqueue(context.Background(), discardLogger, "t/a", ""); !errors.Is(err, errPublisherClosed) {
+		t.Errorf("Enqueue() after Close = %v, want %v", err, errPublisherClosed)
+	}
+}
+
+func TestStatePublisherCloseDeadline(t *testing.T) {
+	withActiveAlerts(t, nil)
+	sink := &fakeSink{name: sinkMQTT, release: make(chan struct{})}
+	defer close(sink.release)
+	p := newStatePublisher(sinks{sink}, "t/default", publishOptions{}, 10, nil)
+
+	if err := p.Enqueue(context.Background(), discardLogger, "t/a", ""); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSinksPublish(t *testing.T) {
+	tests := []struct {
+		name       string
+		fail       []bool
+		wantFailed []string
+	}{
+		{"single ok", []bool{false}, nil},
+		{"single failing", []bool{true}, []string{sinkMQTT}},
+		{"all ok", []bool{false, false, false}, nil},
+		{"one failing", []bool{false, true, false}, []string{sinkNATS}},
+		{"two failing", []bool{true, false, true}, []string{sinkMQTT, sinkKafka}},
+		{"all failing", []bool{true, true, true}, []string{sinkMQTT, sinkNATS, sinkKafka}},
+	}
+	names := []string{sinkMQTT, sinkNATS, sinkKafka}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s sinks
+			for i, fail := range tt.fail {
+				s = append(s, &fakeSink{name: names[i], fail: fail})
+			}
+			err := s.Publish(context.Background(), discardLogger, outgoingMessage{Topic: "t/a"})
+			if tt.wantFailed == nil {
+				if err != nil {
+					t.Fatalf("Publish() = %v, want nil", err)
+				}
+				return
+			}
+			var se *sinkError
+			if !errors.As(err, &se) {
+				t.Fatalf("Publish() = %v, want a *sinkError", err)
+			}
+			if !slices.Equal(se.failed, tt.wantFailed) {
+				t.Errorf("failed sinks = %v, want %v", se.failed, tt.wantFailed)
+			}
+			for i, fail := range tt.fail {
+				if got := s[i].(*fakeSink).topics(); fail == (len(got) != 0) {
+					t.Errorf("sink %s received %v, want failing=%v", names[i], got, fail)
+				}
+			}
+		})
+	}
+}
+
+func TestSinksOnly(t *testing.T) {
+	all := sinks{&fakeSink{name: sinkMQTT}, &fakeSink{name: sinkNATS}, &fakeSink{name: sinkKafka}}
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, []string{sinkMQTT, sinkNATS, sinkKafka}},
+		{[]string{sinkKafka, sinkMQTT}, []string{sinkMQTT, sinkKafka}},
+		{[]string{sinkNATS}, []string{sinkNATS}},
+		{[]string{"other"}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := all.only(tt.names).names(); !slices.Equal(got, tt.want) {
+			t.Errorf("only(%v) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestStatePublisherRetriesFailedSinksOnly(t *testing.T) {
+	withActiveAlerts(t, nil)
+	withRetryInterval(t, 20*time.Millisecond)
+	mqttSink := &fakeSink{name: sinkMQTT}
+	natsSink := &fakeSink{name: sinkNATS, fail: true}
+	kafkaSink := &fakeSink{name: sinkKafka, fail: true}
+	p := newStatePublisher(sinks{mqttSink, natsSink, kafkaSink}, "t/default", publishOptions{}, 10, nil)
+	defer p.Close(context.Background())
+
+	if err := p.Enqueue(context.Background(), discardLogger, "t/a", "nas"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(mqttSink.topics()) == 1 })
+	// A partial success counts as published, so status and the maintenance
+	// watcher see the state the reachable sinks carry
+	last, ok := p.lastPublished("t/a")
+	if !ok || last.State != "NONE" || last.Receiver != "nas" {
+		t.Errorf("lastPublished() = %+v, %v; want the partially published state", last, ok)
+	}
+
+	natsSink.setFail(false)
+	waitFor(t, func() bool { return len(natsSink.topics()) == 1 })
+	kafkaSink.setFail(false)
+	waitFor(t, func() bool { return len(kafkaSink.topics()) == 1 })
+
+	// Give a wrong extra retry the chance to show up
+	time.Sleep(5 * publishRetryInterval)
+	for _, s := range []*fakeSink{mqttSink, natsSink, kafkaSink} {
+		if got := s.topics(); !slices.Equal(got, []string{"t/a"}) {
+			t.Errorf("sink %s received %v, want exactly one publish", s.name, got)
+		}
+	}
+}
+
+func TestStatePublisherTotalFailure(t *testing.T) {
+	withActiveAlerts(t, nil)
+	withRetryInterval(t, time.Hour)
+	mqttSink := &fakeSink{name: sinkMQTT, fail: true}
+	natsSink := &fakeSink{name: sinkNATS, fail: true}
+	p := newStatePublisher(sinks{mqttSink, natsSink}, "t/default", publishOptions{}, 10, nil)
+
+	if err := p.Enqueue(context.Background(), discardLogger, "t/a", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if last, ok := p.lastPublished("t/a"); ok {
+		t.Errorf("lastPublished() = %+v, want nothing after no sink accepted the state", last)
+	}
+	if got := p.failed.Load(); got != 1 {
+		t.Errorf("failed = %d, want 1", got)
+	}
+}
+
+func TestScheduleRetryMergesSinks(t *testing.T) {
+	withRetryInterval(t, 20*time.Millisecond)
+	// No worker, so the retries stay in the queue
+	p := &statePublisher{queue: make(chan publishJob, 10), retryPending: make(map[string]map[string]bool)}
+
+	p.scheduleRetry(publishJob{logger: discardLogger, topic: "t/a", sinks: []string{sinkNATS}})
+	p.scheduleRetry(publishJob{logger: discardLogger, topic: "t/a", sinks: []string{sinkKafka, sinkNATS}})
+	p.scheduleRetry(publishJob{logger: discardLogger, topic: "t/b", sinks: []string{sinkMQTT}})
+
+	want := map[string][]string{
+		"t/a": {sinkKafka, sinkNATS},
+		"t/b": {sinkMQTT},
+	}
+	got := make(map[string][]string)
+	timeout := time.After(time.Second)
+	for len(got) < len(want) {
+		select {
+		case job := <-p.queue:
+			if _, dup := got[job.topic]; dup {
+				t.Errorf("more than one retry queued for %s", job.topic)
+			}
+			got[job.topic] = job.sinks
+		case <-timeout:
+			t.Fatalf("retries queued: %v, want %v", got, want)
+		}
+	}
+	for topic, sinks := range want {
+		if !slices.Equal(got[topic], sinks) {
+			t.Errorf("retry of %s goes to %v, want %v", topic, got[topic], sinks)
+		}
+	}
+
+	time.Sleep(5 * publishRetryInterval)
+	if n := len(p.queue); n != 0 {
+		t.Errorf("%d extra retries queued", n)
+	}
+}
+
+// withRetryInterval sets publishRetryInterval for the duration of the test
+func withRetryInterval(t *testing.T, d time.Duration) {
+	t.Helper()
+	saved := publishRetryInterval
+	publishRetryInterval = d
+	t.Cleanup(func() { publishRetryInterval = saved })
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStatePublisherStaleMuteExpiry(t *testing.T) {
+	withActiveAlerts(t, nil)
+	p := newStatePublisher(sinks{&fakeSink{name: sinkMQTT}}, "t/default", publishOptions{}, 10, nil)
+	defer p.Close(context.Background())
+
+	p.mute(time.Hour)
+	p.mu.Lock()
+	first := p.muteGen
+	p.mu.Unlock()
+	p.mute(2 * time.Hour)
+
+	// The first timer fired but lost the race against the second mute
+	p.expireMute(first)
+	if muted, until := p.muteStatus(); !muted || time.Until(until) < time.Hour {
+		t.Fatalf("muteStatus() = %v, %s; want the second mute to stay", muted, until)
+	}
+
+	p.mu.Lock()
+	second := p.muteGen
+	p.mu.Unlock()
+	p.expireMute(second)
+	if muted, _ := p.muteStatus(); muted {
+		t.Error("second mute did not expire")
+	}
+
+	p.mute(0)
+	p.expireMute(second)
+	if muted, _ := p.muteStatus(); !muted {
+		t.Error("expiry of an earlier mute ended a mute without duration")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// configReloader owns the settings from CONFIG_FILE that can change at runtime:
+// receiver routes and maintenance windows. Reloads swap them in place, so MQTT
+// connections and the HTTP server are unaffected.
+type configReloader struct {
+	path         string
+	defaultTopic string
+	stateFile    string
+	publisher    *statePublisher
+
+	// mu is held for reading while a webhook is routed and tracked, so a
+	// reload never moves alerts between topics halfway through a webhook
+	mu     sync.RWMutex
+	router *router
+
+	statusMu          sync.Mutex
+	lastReloadOK      bool
+	lastReloadSuccess time.Time
+}
+
+func newConfigReloader(path, defaultTopic, stateFile string, cfg *fileConfig, publisher *statePublisher) *configReloader {
+	return &configReloader{
+		path:              path,
+		defaultTopic:      defaultTopic,
+		stateFile:         stateFile,
+		publisher:         publisher,
+		router:            newRouter(defaultTopic, cfg.Routes),
+		lastReloadOK:      true,
+		lastReloadSuccess: time.Now(),
+	}
+}
+
+// track routes the webhook of receiver to its topic and updates the tracked
+// alerts of that topic
+func (c *configReloader) track(logger *slog.Logger, receiver string, alerts []alert) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topic := c.router.topicFor(receiver)
+	updateActiveAlerts(logger, topic, receiver, alerts)
+	return topic
+}
+
+// rerouteRestored moves alerts restored from the state file whose receiver
+// was routed to another topic before the restart, and returns the old and new
+// topics that changed
+func (c *configReloader) rerouteRestored() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return moveAlerts(c.router.topicFor)
+}
+
+// reload re-reads the config file. An invalid file leaves the running
+// configuration untouched.
+func (c *configReloader) reload(logger *slog.Logger) error {
+	if c.path == "" {
+		return errors.New("no CONFIG_FILE configured")
+	}
+
+	cfg, err := loadConfig(c.path)
+	c.statusMu.Lock()
+	c.lastReloadOK = err == nil
+	if err == nil {
+		c.lastReloadSuccess = time.Now()
+	}
+	c.statusMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.router = newRouter(c.defaultTopic, cfg.Routes)
+	// Alerts of receivers whose route changed would otherwise never resolve,
+	// since their resolved notification now goes to the new topic
+	moved := moveAlerts(c.router.topicFor)
+	c.mu.Unlock()
+	c.publisher.setMaintenance(cfg.MaintenanceWindows)
+
+	if len(moved) > 0 && c.stateFile != "" {
+		if err := saveState(c.stateFile); err != nil {
+			logger.Warn("failed to persist alert state", "state_file", c.stateFile, "error", err)
+		}
+	}
+	// Covers the moved topics as well as windows that were added or removed
+	c.publisher.publishChanged(logger)
+
+	logger.Info("reloaded config file", "config_file", c.path, "routes", len(cfg.Routes), "maintenance_windows", len(cfg.MaintenanceWindows), "moved_topics", moved)
+	return nil
+}
+
+func (c *configReloader) reloadStatus() (bool, time.Time) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.lastReloadOK, c.lastReloadSuccess
+}
+
+// reloadHandler serves POST /-/reload like Prometheus and Alertmanager do
+func reloadHandler(c *configReloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		logger := slog.With("request_id", requestID(r), "remote_addr", r.RemoteAddr)
+		if err := c.reload(logger); err != nil {
+			logger.Error("config reload failed", "config_file", c.path, "error", err)
+			http.Error(w, "failed to reload config: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMoveAlerts(t *testing.T) {
+	withActiveAlerts(t, nil)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	firing := func(fingerprint string) []alert {
+		return []alert{{Status: "firing", Fingerprint: fingerprint, Labels: map[string]string{"severity": "critical"}}}
+	}
+	updateActiveAlerts(logger, "t/a", "nas", firing("nas-1"))
+	updateActiveAlerts(logger, "t/a", "router", firing("router-1"))
+	updateActiveAlerts(logger, "t/c", "ups", firing("ups-1"))
+	// Restored from a state file written before alerts recorded their receiver
+	alertsMutex.Lock()
+	activeAlertsMap["t/a"]["legacy-1"] = activeAlert{Topic: "t/a", Fingerprint: "legacy-1", Severity: "warning"}
+	alertsMutex.Unlock()
+
+	r := newRouter("t/a", []route{{Receiver: "nas", Topic: "t/b"}, {Receiver: "ups", Topic: "t/c"}})
+	moved := moveAlerts(r.topicFor)
+	if want := []string{"t/a", "t/b"}; !slices.Equal(moved, want) {
+		t.Errorf("moveAlerts() = %v, want %v", moved, want)
+	}
+
+	alertsMutex.RLock()
+	defer alertsMutex.RUnlock()
+	wantTopics := map[string]string{
+		"nas-1":    "t/b",
+		"router-1": "t/a",
+		"ups-1":    "t/c",
+		"legacy-1": "t/a",
+	}
+	for fingerprint, want := range wantTopics {
+		var found []string
+		for topic, topicAlerts := range activeAlertsMap {
+			if a, ok := topicAlerts[fingerprint]; ok {
+				found = append(found, topic)
+				if a.Topic != topic {
+					t.Errorf("alert %s tracked under %s has Topic %q", fingerprint, topic, a.Topic)
+				}
+			}
+		}
+		if len(found) != 1 || found[0] != want {
+			t.Errorf("alert %s tracked under %v, want [%s]", fingerprint, found, want)
+		}
+	}
+}
+
+func TestMoveAlertsUnchanged(t *testing.T) {
+	withActiveAlerts(t, map[string]map[string]activeAlert{
+		"t/a": {"nas-1": {Topic: "t/a", Receiver: "nas", Fingerprint: "nas-1"}},
+	})
+
+	if moved := moveAlerts(newRouter("t/a", nil).topicFor); len(moved) != 0 {
+		t.Errorf("moveAlerts() = %v, want no topics", moved)
+	}
+}
+
+func TestRerouteRestored(t *testing.T) {
+	withActiveAlerts(t, nil)
+
+	// Saved while "nas" still routed to t/a
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := `{"saved_at": "2026-10-01T00:00:00Z", "alerts": [
+		{"topic": "t/a", "receiver": "nas", "fingerprint": "nas-1", "severity": "critical"},
+		{"topic": "t/a", "receiver": "router", "fingerprint": "router-1", "severity": "warning"}
+	]}`
+	if err := os.WriteFile(path, []byte(state), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(path, "t/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &configReloader{router: newRouter("t/a", []route{{Receiver: "nas", Topic: "t/b"}})}
+	if moved, want := c.rerouteRestored(), []string{"t/a", "t/b"}; !slices.Equal(moved, want) {
+		t.Errorf("rerouteRestored() = %v, want %v", moved, want)
+	}
+	if got := calculateOverallState("t/a", nil); got.State != "WARNING" || got.ActiveAlerts != 1 {
+		t.Errorf("state of t/a = %+v, want the router alert only", got)
+	}
+	if got := calculateOverallState("t/b", nil); got.State != "CRITICAL" || got.ActiveAlerts != 1 {
+		t.Errorf("state of t/b = %+v, want the nas alert only", got)
+	}
+}
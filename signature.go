@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var (
+	errSignatureMissing = errors.New("missing signature")
+	errSignatureInvalid = errors.New("invalid signature")
+)
+
+// verifySignature checks an HMAC-SHA256 signature of body. The signature is
+// hex encoded and may carry a "sha256=" prefix as sent by most signing proxies.
+func verifySignature(secret []byte, signature string, body []byte) error {
+	signature = strings.TrimSpace(signature)
+	if signature == "" {
+		return errSignatureMissing
+	}
+	signature = strings.TrimPrefix(signature, "sha256=")
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return errSignatureInvalid
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errSignatureInvalid
+	}
+	return nil
+}
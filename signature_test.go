@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{"receiver":"homelab","status":"firing"}`)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	valid := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		signature string
+		body      []byte
+		want      error
+	}{
+		{"plain hex", secret, valid, body, nil},
+		{"sha256 prefix", secret, "sha256=" + valid, body, nil},
+		{"upper case hex", secret, strings.ToUpper(valid), body, nil},
+		{"surrounding whitespace", secret, " sha256=" + valid + "\n", body, nil},
+		{"missing", secret, "", body, errSignatureMissing},
+		{"whitespace only", secret, "  ", body, errSignatureMissing},
+		{"prefix only", secret, "sha256=", body, errSignatureInvalid},
+		{"not hex", secret, "sha256=" + strings.Repeat("zz", sha256.Size), body, errSignatureInvalid},
+		{"odd length", secret, valid[1:], body, errSignatureInvalid},
+		{"truncated", secret, valid[:len(valid)-2], body, errSignatureInvalid},
+		{"other prefix", secret, "sha1=" + valid, body, errSignatureInvalid},
+		{"wrong secret", []byte("other"), valid, body, errSignatureInvalid},
+		{"tampered body", secret, valid, []byte(`{"receiver":"homelab","status":"resolved"}`), errSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifySignature(tt.secret, tt.signature, tt.body); !errors.Is(err, tt.want) {
+				t.Errorf("verifySignature() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// silenceRequest is the JSON accepted on the silence topic
+type silenceRequest struct {
+	RequestID string           `json:"request_id,omitempty"`
+	Matchers  []silenceMatcher `json:"matchers"`
+	Duration  string           `json:"duration"`
+	Comment   string           `json:"comment,omitempty"`
+	CreatedBy string           `json:"createdBy,omitempty"`
+}
+
+// silenceMatcher mirrors the Alertmanager API v2 matcher. IsEqual defaults to
+// true so {"name": "alertname", "value": "X"} means alertname="X".
+type silenceMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual *bool  `json:"isEqual,omitempty"`
+}
+
+// silenceResult is published to the result topic after each request
+type silenceResult struct {
+	RequestID string `json:"request_id,omitempty"`
+	Status    string `json:"status"`
+	SilenceID string `json:"silence_id,omitempty"`
+	EndsAt    string `json:"ends_at,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// silencer creates Alertmanager silences from MQTT messages
+type silencer struct {
+	alertmanagerURL string
+	createdBy       string
+	resultTopic     string
+	bridge          *mqttBridge
+	httpClient      *http.Client
+}
+
+// handleMessage runs on the MQTT client's delivery goroutine, so the API
+// call and the result publish happen in the background
+func (s *silencer) handleMessage(topic string, payload []byte) {
+	go s.process(slog.With("silence_topic", topic), payload)
+}
+
+func (s *silencer) process(logger *slog.Logger, payload []byte) {
+	var req silenceRequest
+	result := silenceResult{Status: "created"}
+
+	silenceID, endsAt, err := s.createFromPayload(payload, &req)
+	result.RequestID = req.RequestID
+	if err != nil {
+		logger.Warn("failed to create silence", "request_id", req.RequestID, "error", err)
+		result.Status = "error"
+		result.Error = err.Error()
+	} else {
+		logger.Info("created alertmanager silence", "request_id", req.RequestID, "silence_id", silenceID, "ends_at", endsAt)
+		result.SilenceID = silenceID
+		result.EndsAt = endsAt.Format(time.RFC3339)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("failed to marshal silence result", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := s.bridge.Publish(ctx, logger, outgoingMessage{
+		Topic:   s.resultTopic,
+		QoS:     1,
+		Payload: data,
+	}); err != nil {
+		logger.Error("mqtt publish failed", "topic", s.resultTopic, "error", err)
+	}
+}
+
+func (s *silencer) createFromPayload(payload []byte, req *silenceRequest) (string, time.Time, error) {
+	if err := json.Unmarshal(payload, req); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid silence request: %w", err)
+	}
+	if len(req.Matchers) == 0 {
+		return "", time.Time{}, errors.New("at least one matcher is required")
+	}
+	for _, m := range req.Matchers {
+		if m.Name == "" {
+			return "", time.Time{}, errors.New("matcher name must not be empty")
+		}
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil || d <= 0 {
+		return "", time.Time{}, fmt.Errorf("invalid duration %q", req.Duration)
+	}
+
+	startsAt := time.Now().UTC()
+	endsAt := startsAt.Add(d)
+	id, err := s.create(req, startsAt, endsAt)
+	return id, endsAt, err
+}
+
+// create posts the silence to the Alertmanager API v2 and returns its ID
+func (s *silencer) create(req *silenceRequest, startsAt, endsAt time.Time) (string, error) {
+	type apiMatcher struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+		IsEqual bool   `json:"isEqual"`
+	}
+	body := struct {
+		Matchers  []apiMatcher `json:"matchers"`
+		StartsAt  time.Time    `json:"startsAt"`
+		EndsAt    time.Time    `json:"endsAt"`
+		CreatedBy string       `json:"createdBy"`
+		Comment   string       `json:"comment"`
+	}{
+		StartsAt:  startsAt,
+		EndsAt:    endsAt,
+		CreatedBy: req.CreatedBy,
+		Comment:   req.Comment,
+	}
+	if body.CreatedBy == "" {
+		body.CreatedBy = s.createdBy
+	}
+	if body.Comment == "" {
+		body.Comment = "silenced via MQTT"
+	}
+	for _, m := range req.Matchers {
+		isEqual := m.IsEqual == nil || *m.IsEqual
+		body.Matchers = append(body.Matchers, apiMatcher{Name: m.Name, Value: m.Value, IsRegex: m.IsRegex, IsEqual: isEqual})
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.alertmanagerURL, "/")+"/api/v2/silences", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("alertmanager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("alertmanager returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var created struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", fmt.Errorf("invalid alertmanager response: %w", err)
+	}
+	return created.SilenceID, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConn is a connected broker that records what is published to it
+type fakeConn struct {
+	mu        sync.Mutex
+	published []outgoingMessage
+}
+
+func (c *fakeConn) connect(context.Context) error { return nil }
+
+func (c *fakeConn) publish(_ context.Context, msg outgoingMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, msg)
+	return nil
+}
+
+func (c *fakeConn) subscribe(string, messageHandler) error { return nil }
+func (c *fakeConn) isConnected() bool                      { return true }
+func (c *fakeConn) name() string                           { return "fake" }
+
+// apiSilence is the body the Alertmanager API v2 receives
+type apiSilence struct {
+	Matchers []struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+		IsEqual bool   `json:"isEqual"`
+	} `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+}
+
+func TestSilencerProcess(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		status        int
+		response      string
+		wantRequest   bool
+		wantMatchers  string
+		wantCreatedBy string
+		wantComment   string
+		wantDuration  time.Duration
+		wantResult    silenceResult
+	}{
+		{
+			name:          "defaults",
+			payload:       `{"request_id": "r1", "matchers": [{"name": "alertname", "value": "Backup"}], "duration": "2h"}`,
+			status:        http.StatusOK,
+			response:      `{"silenceID": "abc-123"}`,
+			wantRequest:   true,
+			wantMatchers:  `[{"name":"alertname","value":"Backup","isRegex":false,"isEqual":true}]`,
+			wantCreatedBy: "bridge",
+			wantComment:   "silenced via MQTT",
+			wantDuration:  2 * time.Hour,
+			wantResult:    silenceResult{RequestID: "r1", Status: "created", SilenceID: "abc-123"},
+		},
+		{
+			name: "explicit fields",
+			payload: `{"matchers": [{"name": "instance", "value": "nas.*", "isRegex": true}, {"name": "severity", "value": "info", "isEqual": false}],
+				"duration": "30m", "comment": "disk swap", "createdBy": "alice"}`,
+			status:        http.StatusOK,
+			response:      `{"silenceID": "def-456"}`,
+			wantRequest:   true,
+			wantMatchers:  `[{"name":"instance","value":"nas.*","isRegex":true,"isEqual":true},{"name":"severity","value":"info","isRegex":false,"isEqual":false}]`,
+			wantCreatedBy: "alice",
+			wantComment:   "disk swap",
+			wantDuration:  30 * time.Minute,
+			wantResult:    silenceResult{Status: "created", SilenceID: "def-456"},
+		},
+		{
+			name:        "api error",
+			payload:     `{"request_id": "r3", "matchers": [{"name": "alertname", "value": "X"}], "duration": "1h"}`,
+			status:      http.StatusBadRequest,
+			response:    "invalid matcher\n",
+			wantRequest: true,
+			wantResult:  silenceResult{RequestID: "r3", Status: "error", Error: "alertmanager returned 400 Bad Request: invalid matcher"},
+		},
+		{
+			name:       "no matchers",
+			payload:    `{"request_id": "r5", "duration": "1h"}`,
+			wantResult: silenceResult{RequestID: "r5", Status: "error", Error: "at least one matcher is required"},
+		},
+		{
+			name:       "empty matcher name",
+			payload:    `{"matchers": [{"value": "X"}], "duration": "1h"}`,
+			wantResult: silenceResult{Status: "error", Error: "matcher name must not be empty"},
+		},
+		{
+			name:       "invalid duration",
+			payload:    `{"matchers": [{"name": "alertname", "value": "X"}], "duration": "-1h"}`,
+			wantResult: silenceResult{Status: "error", Error: `invalid duration "-1h"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *apiSilence
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/api/v2/silences" {
+					t.Errorf("got %s %s, want POST /api/v2/silences", r.Method, r.URL.Path)
+				}
+				body, _ := io.ReadAll(r.Body)
+				got = &apiSilence{}
+				if err := json.Unmarshal(body, got); err != nil {
+					t.Errorf("invalid request body %s: %v", body, err)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+
+			conn := &fakeConn{}
+			s := &silencer{
+				alertmanagerURL: server.URL + "/",
+				createdBy:       "bridge",
+				resultTopic:     "t/silence/result",
+				bridge:          &mqttBridge{mode: brokerModeFailover, conns: []brokerConn{conn}, sendMu: make([]sync.Mutex, 1)},
+				httpClient:      server.Client(),
+			}
+			s.process(discardLogger, []byte(tt.payload))
+
+			switch {
+			case got == nil && tt.wantRequest:
+				t.Fatal("no request sent to alertmanager")
+			case got != nil && !tt.wantRequest:
+				t.Fatalf("unexpected request %+v", got)
+			case got != nil && tt.wantMatchers != "":
+				matchers, _ := json.Marshal(got.Matchers)
+				if string(matchers) != tt.wantMatchers {
+					t.Errorf("matchers = %s, want %s", matchers, tt.wantMatchers)
+				}
+				if got.CreatedBy != tt.wantCreatedBy || got.Comment != tt.wantComment {
+					t.Errorf("createdBy, comment = %q, %q; want %q, %q", got.CreatedBy, got.Comment, tt.wantCreatedBy, tt.wantComment)
+				}
+				if d := got.EndsAt.Sub(got.StartsAt); d != tt.wantDuration {
+					t.Errorf("silence lasts %s, want %s", d, tt.wantDuration)
+				}
+			}
+
+			if len(conn.published) != 1 {
+				t.Fatalf("published %d results, want 1", len(conn.published))
+			}
+			msg := conn.published[0]
+			if msg.Topic != "t/silence/result" || msg.Retained {
+				t.Errorf("result published to %q (retained %v), want t/silence/result, not retained", msg.Topic, msg.Retained)
+			}
+			var result silenceResult
+			if err := json.Unmarshal(msg.Payload, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Status == "created" {
+				if _, err := time.Parse(time.RFC3339, result.EndsAt); err != nil {
+					t.Errorf("ends_at %q: %v", result.EndsAt, err)
+				}
+				result.EndsAt = ""
+			}
+			if result != tt.wantResult {
+				t.Errorf("result = %+v, want %+v", result, tt.wantResult)
+			}
+		})
+	}
+}
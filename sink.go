@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	sinkMQTT  = "mqtt"
+	sinkNATS  = "nats"
+	sinkKafka = "kafka"
+)
+
+// Publisher delivers state messages to one sink backend
+type Publisher interface {
+	Name() string
+	// Publish blocks until the sink accepted the message or ctx is done
+	Publish(ctx context.Context, logger *slog.Logger, msg outgoingMessage) error
+	// Status returns the connection state of the sink's brokers
+	Status() []brokerStatus
+}
+
+// parseSinks splits a comma-separated SINK value into sink names
+func parseSinks(value string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		switch name {
+		case sinkMQTT, sinkNATS, sinkKafka:
+		default:
+			return nil, fmt.Errorf("invalid SINK %q (expected %s, %s or %s)", name, sinkMQTT, sinkNATS, sinkKafka)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate SINK %q", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no SINK configured")
+	}
+	return names, nil
+}
+
+// sinkError lists the sinks a fan-out publish did not reach
+type sinkError struct {
+	failed []string
+	err    error
+}
+
+func (e *sinkError) Error() string { return e.err.Error() }
+func (e *sinkError) Unwrap() error { return e.err }
+
+// sinks fans every publish out to all configured sinks in parallel. A failed
+// publish returns a *sinkError, so the caller can retry just the sinks that
+// failed while recording the delivery to the others.
+type sinks []Publisher
+
+// only returns the sinks named in names, or all sinks if names is empty
+func (s sinks) only(names []string) sinks {
+	if len(names) == 0 {
+		return s
+	}
+	var selected sinks
+	for _, p := range s {
+		if slices.Contains(names, p.Name()) {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+func (s sinks) names() []string {
+	names := make([]string, 0, len(s))
+	for _, p := range s {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+func (s sinks) Name() string {
+	return strings.Join(s.names(), ",")
+}
+
+func (s sinks) Publish(ctx context.Context, logger *slog.Logger, msg outgoingMessage) error {
+	if len(s) == 1 {
+		if err := s[0].Publish(ctx, logger, msg); err != nil {
+			return &sinkError{failed: []string{s[0].Name()}, err: err}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(s))
+	var wg sync.WaitGroup
+	for i, p := range s {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Publish(ctx, logger.With("sink", p.Name()), msg); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", p.Name(), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, s[i].Name())
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &sinkError{failed: failed, err: errors.Join(errs...)}
+}
+
+func (s sinks) Status() []brokerStatus {
+	var statuses []brokerStatus
+	for _, p := range s {
+		statuses = append(statuses, p.Status()...)
+	}
+	return statuses
+}
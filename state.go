@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateFileMutex serialises saveState so concurrent webhooks cannot rename
+// an older snapshot over a newer one
+var stateFileMutex sync.Mutex
+
+// persistedState is the on-disk representation of the active alerts map. Each
+// alert carries its topic; alerts saved before topic routing existed have none
+// and are restored to the default topic.
+type persistedState struct {
+	SavedAt time.Time     `json:"saved_at"`
+	Alerts  []activeAlert `json:"alerts"`
+}
+
+// saveState writes the active alerts to path. The file is replaced atomically
+// so a crash mid-write never leaves a truncated state behind.
+func saveState(path string) error {
+	stateFileMutex.Lock()
+	defer stateFileMutex.Unlock()
+
+	alertsMutex.RLock()
+	state := persistedState{
+		SavedAt: time.Now().UTC(),
+		Alerts:  []activeAlert{},
+	}
+	for _, topicAlerts := range activeAlertsMap {
+		for _, a := range topicAlerts {
+			state.Alerts = append(state.Alerts, a)
+		}
+	}
+	alertsMutex.RUnlock()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadState restores the active alerts map from path. A missing file is not
+// an error; it simply means there is nothing to restore.
+func loadState(path, defaultTopic string) (persistedState, error) {
+	var state persistedState
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+
+	alertsMutex.Lock()
+	defer alertsMutex.Unlock()
+	for _, a := range state.Alerts {
+		if a.Fingerprint == "" {
+			continue
+		}
+		if a.Topic == "" {
+			a.Topic = defaultTopic
+		}
+		if activeAlertsMap[a.Topic] == nil {
+			activeAlertsMap[a.Topic] = make(map[string]activeAlert)
+		}
+		activeAlertsMap[a.Topic][a.Fingerprint] = a
+	}
+	return state, nil
+}
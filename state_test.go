@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveLoadStateRoundTrip(t *testing.T) {
+	startsAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	alerts := map[string]map[string]activeAlert{
+		"t/a": {
+			"nas-1":    {Topic: "t/a", Receiver: "nas", Fingerprint: "nas-1", Severity: "critical", Labels: map[string]string{"instance": "nas"}, StartsAt: startsAt},
+			"router-1": {Topic: "t/a", Receiver: "router", Fingerprint: "router-1", Severity: "warning"},
+		},
+		"t/b": {
+			"ups-1": {Topic: "t/b", Receiver: "ups", Fingerprint: "ups-1", Severity: "info"},
+		},
+	}
+	withActiveAlerts(t, alerts)
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := saveState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	withActiveAlerts(t, nil)
+	state, err := loadState(path, "t/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.SavedAt.IsZero() {
+		t.Error("SavedAt not restored")
+	}
+	alertsMutex.RLock()
+	defer alertsMutex.RUnlock()
+	if !reflect.DeepEqual(activeAlertsMap, alerts) {
+		t.Errorf("restored %+v, want %+v", activeAlertsMap, alerts)
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // empty means no file
+		want    map[string]map[string]activeAlert
+		wantErr string
+	}{
+		{name: "missing file", want: map[string]map[string]activeAlert{}},
+		{
+			name: "legacy entry without topic",
+			content: `{"saved_at": "2026-10-01T00:00:00Z", "alerts": [
+				{"fingerprint": "old-1", "severity": "warning"}
+			]}`,
+			want: map[string]map[string]activeAlert{
+				"t/default": {"old-1": {Topic: "t/default", Fingerprint: "old-1", Severity: "warning"}},
+			},
+		},
+		{
+			name: "entry without fingerprint",
+			content: `{"saved_at": "2026-10-01T00:00:00Z", "alerts": [
+				{"topic": "t/a", "severity": "critical"},
+				{"topic": "t/a", "fingerprint": "a-1", "severity": "info"}
+			]}`,
+			want: map[string]map[string]activeAlert{
+				"t/a": {"a-1": {Topic: "t/a", Fingerprint: "a-1", Severity: "info"}},
+			},
+		},
+		{name: "invalid json", content: `{"alerts": [`, wantErr: "invalid state file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withActiveAlerts(t, nil)
+			path := filepath.Join(t.TempDir(), "state.json")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := loadState(path, "t/default")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadState() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadState() = %v, want nil", err)
+			}
+			alertsMutex.RLock()
+			defer alertsMutex.RUnlock()
+			if !reflect.DeepEqual(activeAlertsMap, tt.want) {
+				t.Errorf("restored %+v, want %+v", activeAlertsMap, tt.want)
+			}
+		})
+	}
+}
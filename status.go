@@ -0,0 +1,106 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+//go:embed status.html
+var statusPage []byte
+
+type statusResponse struct {
+	Topics       []topicStatus  `json:"topics"`
+	Alerts       []alertStatus  `json:"alerts"`
+	Maintenance  []string       `json:"maintenance_windows_active"`
+	Muted        bool           `json:"muted"`
+	MutedUntil   *time.Time     `json:"muted_until,omitempty"`
+	PublishQueue map[string]int `json:"publish_queue"`
+	Sinks        []brokerStatus `json:"sinks"`
+	// MQTT is omitted without the mqtt sink
+	MQTT *mqttStatus `json:"mqtt,omitempty"`
+}
+
+type topicStatus struct {
+	Topic         string          `json:"topic"`
+	State         string          `json:"state"`
+	ActiveAlerts  int             `json:"active_alerts"`
+	Maintenance   bool            `json:"maintenance"`
+	LastPublished *publishedState `json:"last_published"`
+}
+
+// alertStatus is a tracked alert plus how maintenance windows affect it
+type alertStatus struct {
+	activeAlert
+	Maintenance bool `json:"maintenance"`
+	Suppressed  bool `json:"suppressed"`
+}
+
+type mqttStatus struct {
+	DefaultTopic    string         `json:"default_topic"`
+	BrokerMode      string         `json:"broker_mode"`
+	ProtocolVersion string         `json:"protocol_version"`
+	Brokers         []brokerStatus `json:"brokers"`
+}
+
+// statusHandler serves GET /status, the bridge's view of the world as JSON
+func statusHandler(bridge *mqttBridge, sink Publisher, publisher *statePublisher, topic, protocolVersion string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		depth, capacity := publisher.QueueDepth()
+		muted, until := publisher.muteStatus()
+
+		windows := activeMaintenanceWindows(publisher.maintenanceWindows(), time.Now())
+		response := statusResponse{
+			Alerts:      []alertStatus{},
+			Maintenance: []string{},
+			Muted:       muted,
+			PublishQueue: map[string]int{
+				"depth":    depth,
+				"capacity": capacity,
+			},
+			Sinks: sink.Status(),
+		}
+		if bridge != nil {
+			response.MQTT = &mqttStatus{
+				DefaultTopic:    topic,
+				BrokerMode:      bridge.mode,
+				ProtocolVersion: protocolVersion,
+				Brokers:         bridge.Status(),
+			}
+		}
+		for _, w := range windows {
+			response.Maintenance = append(response.Maintenance, w.Name)
+		}
+		for _, a := range snapshotActiveAlerts() {
+			_, covered, suppressed := applyMaintenance(a, windows)
+			response.Alerts = append(response.Alerts, alertStatus{activeAlert: a, Maintenance: covered, Suppressed: suppressed})
+		}
+		for _, t := range publisher.topics() {
+			state := calculateOverallState(t, windows)
+			ts := topicStatus{Topic: t, State: state.State, ActiveAlerts: state.ActiveAlerts, Maintenance: state.Maintenance}
+			if last, ok := publisher.lastPublished(t); ok {
+				ts.LastPublished = &last
+			}
+			response.Topics = append(response.Topics, ts)
+		}
+		if muted && !until.IsZero() {
+			response.MutedUntil = &until
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// statusPageHandler serves the embedded HTML page that renders /status
+func statusPageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(statusPage)
+}